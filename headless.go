@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"polish/rpn"
+)
+
+// stdinInput answers the 'prompt' command from the standard input.
+type stdinInput struct {
+	out    io.Writer
+	reader *bufio.Reader
+}
+
+func (s *stdinInput) Input(prompt string) (string, error) {
+	fmt.Fprint(s.out, prompt+" ")
+	input, err := s.reader.ReadString('\n')
+	if err != nil && input == "" {
+		return "", err
+	}
+	return strings.TrimRight(input, "\r\n"), nil
+}
+
+// runHeadless evaluates a script or an expression without the TUI and returns the exit status.
+//
+// Usage: polish run [-sandbox] [-stack] [-e expr] [file.rpn]
+//
+// The output of '.', 'cr', 'emit'... goes to stdout, errors go to stderr.
+// A file named "-" is read from the standard input.
+func runHeadless(args []string) int {
+	if len(args) > 0 && args[0] == "run" {
+		args = args[1:]
+	}
+
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	expr := flags.String("e", "", "evaluate the given expression")
+	showStack := flags.Bool("stack", false, "print the final stack")
+	sandbox := flags.Bool("sandbox", false, "refuse the access to files (save, restore, import...)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: polish run [-sandbox] [-stack] [-e expr] [file.rpn]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *expr == "" && flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	stdout := os.Stdout
+	stderr := os.Stderr
+	interpreter := rpn.NewInterpreter(rpn.Options{
+		Output:  stdout,
+		Input:   &stdinInput{out: stdout, reader: bufio.NewReader(os.Stdin)},
+		Help:    CleanMarkdown(readmeContent),
+		Version: _version,
+		Sandbox: *sandbox,
+	})
+
+	var err error
+	if *expr != "" {
+		err = interpreter.Eval(*expr)
+	} else {
+		var content []byte
+		source := flags.Arg(0)
+		if source == "-" {
+			source = "<stdin>"
+			content, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			content, err = ioutil.ReadFile(source)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to read RPN file %s\n%v\n", flags.Arg(0), err)
+			return 1
+		}
+		err = interpreter.EvalScript(source, string(content))
+	}
+	if err != nil && !errors.Is(err, rpn.ErrExit) {
+		fmt.Fprintln(stderr, err.Error())
+		var perr *rpn.PolishError
+		if errors.As(err, &perr) {
+			for _, line := range perr.Traceback() {
+				fmt.Fprintln(stderr, "  "+line)
+			}
+		}
+	}
+
+	if *showStack {
+		stack := interpreter.Stack()
+		for k, item := range stack {
+			fmt.Fprintf(stdout, "%06d: %s\n", len(stack)-1-k, interpreter.Format(item))
+		}
+	}
+
+	if err != nil && !errors.Is(err, rpn.ErrExit) {
+		return 1
+	}
+	return 0
+}
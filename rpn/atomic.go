@@ -0,0 +1,57 @@
+package rpn
+
+// snapshot is a copy of the state of the interpreter, taken before evaluating
+// code in atomic mode and restored if the evaluation fails, or recorded in the
+// undo history.
+type snapshot struct {
+	label     string // Command evaluated after the snapshot, for the undo history
+	stack     []interface{}
+	lastX     interface{}
+	variables map[string]interface{} // Only for a full snapshot
+	words     map[string][]string    // Only for a full snapshot
+}
+
+// atomic reports whether the state must be restored when an evaluation fails.
+func (i *Interpreter) atomic() bool {
+	return i.Flag("_atomic") || i.Flag("_atomic_all")
+}
+
+// takeSnapshot copies the stack and _last_x, and the variables and words for a
+// full snapshot. Values are never modified in place, so the copies are shallow.
+func (i *Interpreter) takeSnapshot(full bool) *snapshot {
+	s := &snapshot{
+		stack: append([]interface{}(nil), i.stack...),
+		lastX: i.variables["_last_x"],
+	}
+	if full {
+		s.variables = make(map[string]interface{}, len(i.variables))
+		for name, val := range i.variables {
+			s.variables[name] = val
+		}
+		s.words = make(map[string][]string, len(i.words))
+		for name, def := range i.words {
+			s.words[name] = def
+		}
+	}
+	return s
+}
+
+// restore puts back the state saved by takeSnapshot, keeping _error and
+// _last_error which report the failure, and _sandbox which cannot be turned off.
+func (i *Interpreter) restore(s *snapshot) {
+	i.stack = s.stack
+	if s.variables != nil {
+		failed, lastError, sandbox := i.variables["_error"], i.variables["_last_error"], i.variables["_sandbox"]
+		// The global scope is shared with scopeStack, so it is updated in place
+		for name := range i.variables {
+			delete(i.variables, name)
+		}
+		for name, val := range s.variables {
+			i.variables[name] = val
+		}
+		i.variables["_error"], i.variables["_last_error"], i.variables["_sandbox"] = failed, lastError, sandbox
+		i.words = s.words
+		i.wordsChanged()
+	}
+	i.variables["_last_x"] = s.lastX
+}
@@ -0,0 +1,245 @@
+package rpn
+
+import (
+	"math/big"
+	"strings"
+)
+
+// Programmer mode: integers can be written and displayed in hexadecimal, octal
+// and binary, and wrap around _word_size bits, signed or not, when it is not 0.
+
+// wordSizes lists the values of _word_size.
+var wordSizes = []int{0, 8, 16, 32, 64}
+
+// baseNames lists the values of _base.
+var baseNames = []string{"dec", "hex", "oct", "bin"}
+
+// bases gives the radix and the literal prefix of the values of _base.
+var bases = map[string]struct {
+	radix  int
+	prefix string
+}{
+	"dec": {10, ""},
+	"hex": {16, "0x"},
+	"oct": {8, "0o"},
+	"bin": {2, "0b"},
+}
+
+// parseRadix parses an integer literal written with a 0x, 0o or 0b prefix and
+// an optional sign.
+func parseRadix(token string) (*big.Int, bool) {
+	digits := token
+	if len(digits) > 0 && (digits[0] == '-' || digits[0] == '+') {
+		digits = digits[1:]
+	}
+	if len(digits) < 3 || digits[0] != '0' {
+		return nil, false
+	}
+	var radix int
+	switch digits[1] {
+	case 'x', 'X':
+		radix = 16
+	case 'o', 'O':
+		radix = 8
+	case 'b', 'B':
+		radix = 2
+	default:
+		return nil, false
+	}
+	n, ok := new(big.Int).SetString(digits[2:], radix)
+	if !ok || strings.ContainsAny(digits[2:], "_+-") {
+		return nil, false
+	}
+	if token[0] == '-' {
+		n.Neg(n)
+	}
+	return n, true
+}
+
+// wordSize returns the value of _word_size, 0 for unlimited integers.
+func (i *Interpreter) wordSize() int {
+	n, _ := toFloat(i.variables["_word_size"])
+	return int(n)
+}
+
+// wrap reduces an integer to the word size, as a signed or unsigned integer.
+func (i *Interpreter) wrap(n *big.Int) *big.Int {
+	size := i.wordSize()
+	if size == 0 {
+		return n
+	}
+	// And works on the two's complement of negative numbers
+	r := new(big.Int).And(n, mask(size))
+	if i.Flag("_signed") && r.Bit(size-1) == 1 {
+		r.Sub(r, new(big.Int).Lsh(big.NewInt(1), uint(size)))
+	}
+	return r
+}
+
+// wrapValue wraps a number if it is an integer.
+func (i *Interpreter) wrapValue(v interface{}) interface{} {
+	if n, ok := v.(*big.Int); ok {
+		return i.wrap(n)
+	}
+	return v
+}
+
+// mask returns 2^size - 1.
+func mask(size int) *big.Int {
+	m := new(big.Int).Lsh(big.NewInt(1), uint(size))
+	return m.Sub(m, big.NewInt(1))
+}
+
+// formatInteger formats an integer in the _base radix, a negative integer
+// being displayed as its two's complement when a word size is set.
+func (i *Interpreter) formatInteger(n *big.Int) string {
+	base, ok := i.variables["_base"].(string)
+	if !ok || base == "dec" {
+		return n.String()
+	}
+	if size := i.wordSize(); size > 0 && n.Sign() < 0 {
+		n = new(big.Int).And(n, mask(size))
+	}
+	if n.Sign() < 0 {
+		return "-" + bases[base].prefix + strings.ToUpper(new(big.Int).Neg(n).Text(bases[base].radix))
+	}
+	return bases[base].prefix + strings.ToUpper(n.Text(bases[base].radix))
+}
+
+// popInteger pops an integer, a boolean being converted to 0 or 1.
+func (i *Interpreter) popInteger(word string) (*big.Int, error) {
+	val, err := i.popNumber()
+	if err != nil {
+		return nil, err
+	}
+	n, ok := val.(*big.Int)
+	if !ok {
+		return nil, i.newError(84, word, TypeName(val))
+	}
+	return n, nil
+}
+
+// popShift pops the count, which must not be negative, and the integer of a
+// shift or a rotation, the integer being wrapped to the word size.
+func (i *Interpreter) popShift(word string) (*big.Int, int, error) {
+	count, err := i.popInteger(word)
+	if err != nil {
+		return nil, 0, err
+	}
+	n, err := i.popInteger(word)
+	if err != nil {
+		return nil, 0, err
+	}
+	if count.Sign() < 0 {
+		return nil, 0, i.newError(102, word, count.String())
+	}
+	if !count.IsInt64() || count.Int64() > maxIntBits {
+		return nil, 0, i.newError(79, word)
+	}
+	return i.wrap(n), int(count.Int64()), nil
+}
+
+// shift shifts an integer to the left, or to the right for a negative count,
+// as 'shr' does.
+func (i *Interpreter) shift(n *big.Int, count int) *big.Int {
+	if count < 0 {
+		return i.wrap(new(big.Int).Rsh(n, uint(-count)))
+	}
+	return i.wrap(new(big.Int).Lsh(n, uint(count)))
+}
+
+// rotate rotates the bits of an integer to the left, or to the right for a
+// negative count, as 'ror' does, within the word size.
+func (i *Interpreter) rotate(word string, n *big.Int, count int) (*big.Int, error) {
+	size := i.wordSize()
+	if size == 0 {
+		return nil, i.newError(85, word)
+	}
+	count = ((count % size) + size) % size
+	u := new(big.Int).And(n, mask(size))
+	r := new(big.Int).Lsh(u, uint(count))
+	r.Or(r, new(big.Int).Rsh(u, uint(size-count)))
+	return i.wrap(r.And(r, mask(size))), nil
+}
+
+// registerBitOpcodes registers the bitwise words and the words setting the display base.
+func (i *Interpreter) registerBitOpcodes() {
+	bitwise := func(word string, op func(z, x, y *big.Int) *big.Int) func(*Interpreter) error {
+		return func(i *Interpreter) error {
+			b, err := i.popInteger(word)
+			if err != nil {
+				return err
+			}
+			a, err := i.popInteger(word)
+			if err != nil {
+				return err
+			}
+			i.push(i.wrap(op(new(big.Int), i.wrap(a), i.wrap(b))))
+			return nil
+		}
+	}
+	i.opcodes["band"] = bitwise("band", (*big.Int).And)
+	i.opcodes["bor"] = bitwise("bor", (*big.Int).Or)
+	i.opcodes["bxor"] = bitwise("bxor", (*big.Int).Xor)
+
+	i.opcodes["bnot"] = func(i *Interpreter) error {
+		a, err := i.popInteger("bnot")
+		if err != nil {
+			return err
+		}
+		i.push(i.wrap(new(big.Int).Not(i.wrap(a))))
+		return nil
+	}
+
+	// n count shl
+	i.opcodes["shl"] = func(i *Interpreter) error {
+		n, count, err := i.popShift("shl")
+		if err != nil {
+			return err
+		}
+		i.push(i.shift(n, count))
+		return nil
+	}
+	i.opcodes["shr"] = func(i *Interpreter) error {
+		n, count, err := i.popShift("shr")
+		if err != nil {
+			return err
+		}
+		i.push(i.shift(n, -count))
+		return nil
+	}
+
+	// n count rol
+	i.opcodes["rol"] = func(i *Interpreter) error {
+		n, count, err := i.popShift("rol")
+		if err != nil {
+			return err
+		}
+		r, err := i.rotate("rol", n, count)
+		if err != nil {
+			return err
+		}
+		i.push(r)
+		return nil
+	}
+	i.opcodes["ror"] = func(i *Interpreter) error {
+		n, count, err := i.popShift("ror")
+		if err != nil {
+			return err
+		}
+		r, err := i.rotate("ror", n, -count)
+		if err != nil {
+			return err
+		}
+		i.push(r)
+		return nil
+	}
+
+	// Display base
+	for _, base := range baseNames {
+		i.opcodes[base] = func(i *Interpreter) error {
+			i.variables["_base"] = base
+			return nil
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package rpn
+
+import "strings"
+
+// instrKind is the kind of a compiled instruction.
+type instrKind int
+
+const (
+	pushValue   instrKind = iota // Push a string or a code block
+	callOpcode                   // Call a built-in or registered opcode
+	callWordRef                  // Execute a word called with 'word:'
+	callVarRef                   // Execute or push a variable called with 'var:'
+	callName                     // Execute a word or a variable, or push a literal
+)
+
+// instr is a compiled token. Words and variables are resolved when the
+// instruction runs, as they can be defined after the compilation.
+type instr struct {
+	kind  instrKind
+	at    int                      // Index of the token, for error tracebacks
+	value interface{}              // Value pushed by pushValue, or literal of callName
+	dec   *decimal                 // Literal of callName in _decimal mode, if different
+	radix bool                     // Literal of callName written 0x, 0o or 0b, wrapped to the word size
+	fn    func(*Interpreter) error // Opcode called by callOpcode
+	name  string                   // Name of the word or variable
+
+	// Definition of the word called by callName, valid while the generation of
+	// the interpreter is unchanged
+	generation int
+	wordDef    []string
+	isWord     bool
+}
+
+// program is a compiled sequence of tokens.
+type program struct {
+	code []instr
+}
+
+// programKey identifies a sequence of tokens by its first element and length.
+// Sequences of tokens are never modified once parsed, so the programs compiled
+// from them can be reused.
+type programKey struct {
+	first *string
+	n     int
+}
+
+// maxPrograms is the number of programs kept before the cache is cleared.
+const maxPrograms = 4096
+
+// compiled returns the program compiled from a sequence of tokens, or nil if the
+// tokens must be interpreted.
+func (i *Interpreter) compiled(tokens []string) *program {
+	if len(tokens) == 0 {
+		return nil
+	}
+	key := programKey{first: &tokens[0], n: len(tokens)}
+	if prog, ok := i.programs[key]; ok {
+		return prog
+	}
+	if len(i.programs) >= maxPrograms {
+		i.programs = make(map[programKey]*program)
+	}
+	prog := i.compile(tokens)
+	i.programs[key] = prog
+	return prog
+}
+
+// compile turns a sequence of tokens into instructions: the comments are removed,
+// the literals parsed, the opcodes looked up and the code blocks delimited. It
+// returns nil if the tokens contain a definition, a command reading the next
+// token ('delete', 'see', 'help', 'edit', 'editfile') or a syntax error, which are
+// left to interpret.
+func (i *Interpreter) compile(tokens []string) *program {
+	prog := &program{code: make([]instr, 0, len(tokens))}
+	commentLevel := 0
+	for j := 0; j < len(tokens); j++ {
+		token := tokens[j]
+
+		if commentLevel > 0 {
+			if token == "(" {
+				commentLevel++
+			} else if token == ")" {
+				commentLevel--
+			}
+			continue
+		}
+		if token == "(" {
+			commentLevel++
+			continue
+		}
+
+		if len(token) > 1 && token[0] == '"' && token[len(token)-1] == '"' {
+			prog.code = append(prog.code, instr{kind: pushValue, at: j, value: token[1 : len(token)-1]})
+			continue
+		}
+
+		switch token {
+		case ":", ";", "delete", "see", "help", "editfile", "edit":
+			return nil
+		case "{":
+			end := blockEnd(tokens, j)
+			if end < 0 {
+				return nil
+			}
+			prog.code = append(prog.code, instr{kind: pushValue, at: j, value: tokens[j+1 : end : end]})
+			j = end
+			continue
+		}
+
+		if op, exists := i.opcodes[token]; exists {
+			if op == nil {
+				// Parser token out of its context, such as a '}' without '{'
+				misplaced := token
+				op = func(i *Interpreter) error { return i.misplaced(misplaced) }
+			}
+			prog.code = append(prog.code, instr{kind: callOpcode, at: j, fn: op})
+		} else if strings.HasPrefix(token, "word:") {
+			prog.code = append(prog.code, instr{kind: callWordRef, at: j, name: strings.TrimPrefix(token, "word:")})
+		} else if strings.HasPrefix(token, "var:") {
+			prog.code = append(prog.code, instr{kind: callVarRef, at: j, name: strings.TrimPrefix(token, "var:")})
+		} else {
+			val, _ := parseLiteral(token)
+			dec, _ := modeDecimal(token)
+			_, radix := parseRadix(token)
+			prog.code = append(prog.code, instr{kind: callName, at: j, name: token, value: val, dec: dec, radix: radix, generation: -1})
+		}
+	}
+	if commentLevel > 0 {
+		return nil
+	}
+	return prog
+}
+
+// blockEnd returns the index of the '}' closing the block opened at start, or -1.
+func blockEnd(tokens []string, start int) int {
+	balance := 0
+	for j := start; j < len(tokens); j++ {
+		if tokens[j] == "{" {
+			balance++
+		} else if tokens[j] == "}" {
+			balance--
+			if balance == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// run executes a compiled program, as interpret does for its tokens.
+func (i *Interpreter) run(tokens []string, prog *program) (err error) {
+	i.variables["_error"] = false
+	pc := 0
+	// Errors raised while executing an instruction are located at its token
+	defer func() {
+		if err != nil && pc < len(prog.code) {
+			err = i.atToken(err, &tokens[prog.code[pc].at])
+		}
+	}()
+	for ; pc < len(prog.code); pc++ {
+		// Check for interruption
+		if err := i.checkpoint(); err != nil {
+			return err
+		}
+
+		in := &prog.code[pc]
+		call := &tokens[in.at]
+		switch in.kind {
+		case pushValue:
+			i.push(in.value)
+		case callOpcode:
+			err = in.fn(i)
+		case callWordRef:
+			err = i.callExplicitWord(in.name, call)
+		case callVarRef:
+			err = i.callExplicitVariable(in.name, call)
+		case callName:
+			if in.generation != i.generation {
+				in.wordDef, in.isWord = i.words[in.name]
+				in.generation = i.generation
+			}
+			if in.isWord {
+				err = i.callWord(in.name, in.wordDef, true, call)
+			} else if val, exists := i.variables[in.name]; exists {
+				err = i.callVariable(in.name, val, true, call)
+			} else if in.dec != nil && i.Flag("_decimal") {
+				i.push(in.dec)
+			} else if in.radix {
+				i.push(i.wrapValue(in.value))
+			} else if in.value != nil {
+				i.push(in.value)
+			} else {
+				err = i.newError(34, in.name)
+			}
+		}
+		if err == nil {
+			err = i.checkDepth()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wordsChanged invalidates the words resolved by the compiled programs, forgets
+// the positions no word refers to any more and notifies the change.
+func (i *Interpreter) wordsChanged() {
+	i.generation++
+	i.forgetSources()
+	i.notify(WordsChanged)
+}
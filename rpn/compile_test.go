@@ -0,0 +1,70 @@
+package rpn
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// evalStack evaluates the source on a new interpreter and returns its stack as
+// written, followed by the code of the error if the evaluation failed.
+func evalStack(source string, noCompile bool) string {
+	i := NewInterpreter(Options{})
+	i.noCompile = noCompile
+	err := i.Eval(source)
+	var items []string
+	for _, val := range i.Stack() {
+		items = append(items, i.formatItem(val))
+	}
+	if err != nil {
+		var perr *PolishError
+		if errors.As(err, &perr) {
+			items = append(items, fmt.Sprintf("error %d", perr.Code))
+		} else {
+			items = append(items, "error "+err.Error())
+		}
+	}
+	return strings.Join(items, " ")
+}
+
+func TestCompiledMatchesInterpreted(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"arithmetic", "1 2 + 3 *", "9"},
+		{"exact", "7 2 / 6 3 / 1/3 1/6 +", "3.5 2 1/2"},
+		{"big integers", "2 64 pow 1 +", "18446744073709551617"},
+		{"decimals", "0.1d 0.2d + 1d 3d /", "0.3 0.3333333333333333333333333333333333"},
+		{"complex", "(1,2) (3,4) *", "(-5,10)"},
+		{"matrices", "[| 1 2 | 3 4 |] [| 1 0 | 0 1 |] * transpose", "[| 1 3 | 2 4 |]"},
+		{"strings", `"héllo" len "a" "b" <`, "5 true"},
+		{"lists", "[ 1 2 3 ] { dup * } map { + } reduce", "14"},
+		{"maps", `<< "a" 1 >> "a" get`, "1"},
+		{"variables", `5 "x" store x x * { 2 * } "dbl" store 3 dbl`, "25 6"},
+		{"loops", "0 1 10 1 { index + } for 0 5 { index + } loop", "55 10"},
+		{"while conditions", "3 { dup 1/3 * } { 1 - } while 2 { dup 0.5d * } { 1 - } while", "0 0"},
+		{"recursion", ": fact dup 1 > { dup 1 - fact * } if ; 20 fact", "2432902008176640000"},
+		{"word redefinition", ": f 1 ; : g f ; g : f 2 ; g", "1 2"},
+		{"word deletion", ": f 1 ; : g f ; g delete f 5 \"f\" store g", "1 5"},
+		{"decimal literals", `: h 0.1 0.2 + ; h "_decimal" set h 0.1 0.2 +`, "0.30000000000000004 0.3 0.3"},
+		{"radix literals", `: w 0x1FF ; w 8 "_word_size" store w`, "511 -1"},
+		{"caught error", "{ 1 0 / } catch", "2"},
+		{"division by zero", "1 0 /", "error 2"},
+		{"unknown token", "nosuch", "error 34"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compiled := evalStack(test.source, false)
+			interpreted := evalStack(test.source, true)
+			if compiled != test.want {
+				t.Errorf("compiled %q: got %q, want %q", test.source, compiled, test.want)
+			}
+			if interpreted != test.want {
+				t.Errorf("interpreted %q: got %q, want %q", test.source, interpreted, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package rpn
+
+import (
+	"math"
+	"math/cmplx"
+	"strconv"
+	"strings"
+)
+
+// Complex numbers are complex128 values, written (re,im) or made with '->cx'.
+// The math functions return a complex number for a complex argument, and in
+// _complex mode for a real argument outside of their real domain, such as the
+// square root of a negative number.
+
+// parseComplex parses a complex literal such as (3,4) or (-1.5,0.5).
+func parseComplex(token string) (complex128, bool) {
+	if len(token) < 5 || token[0] != '(' || token[len(token)-1] != ')' {
+		return 0, false
+	}
+	parts := strings.Split(token[1:len(token)-1], ",")
+	if len(parts) != 2 {
+		return 0, false
+	}
+	re, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, false
+	}
+	im, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	return complex(re, im), true
+}
+
+// formatComplex formats a complex number as a literal.
+func formatComplex(z complex128) string {
+	return "(" + strconv.FormatFloat(real(z), 'g', -1, 64) + "," + strconv.FormatFloat(imag(z), 'g', -1, 64) + ")"
+}
+
+// asComplex returns the complex value of an argument which must be computed as
+// a complex number: a complex number, or in _complex mode a real number out of
+// the real domain of a function.
+func (i *Interpreter) asComplex(v interface{}, outOfDomain func(float64) bool) (complex128, bool) {
+	if z, ok := v.(complex128); ok {
+		return z, true
+	}
+	if outOfDomain == nil || !i.Flag("_complex") {
+		return 0, false
+	}
+	if x, _ := toFloat(v); outOfDomain(x) {
+		return complex(x, 0), true
+	}
+	return 0, false
+}
+
+// isNegative is the real domain test of sqrt, ln and log.
+func isNegative(x float64) bool {
+	return x < 0
+}
+
+// outsideUnit is the real domain test of asin and acos.
+func outsideUnit(x float64) bool {
+	return x < -1 || x > 1
+}
+
+// angleFromRadians converts an angle to the unit of _degree_mode.
+func (i *Interpreter) angleFromRadians(a float64) float64 {
+	if i.Flag("_degree_mode") {
+		return a * 180 / math.Pi
+	}
+	return a
+}
+
+// angleToRadians converts an angle in the unit of _degree_mode to radians.
+func (i *Interpreter) angleToRadians(a float64) float64 {
+	if i.Flag("_degree_mode") {
+		return a * math.Pi / 180
+	}
+	return a
+}
+
+// popComplex pops a number, converted to a complex number.
+func (i *Interpreter) popComplex() (complex128, error) {
+	val, err := i.popNumber()
+	if err != nil {
+		return 0, err
+	}
+	return convert(val, rankComplex).(complex128), nil
+}
+
+// registerComplexOpcodes registers the words building and decomposing complex numbers.
+func (i *Interpreter) registerComplexOpcodes() {
+	// re im ->cx
+	i.opcodes["->cx"] = func(i *Interpreter) error {
+		im, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		re, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		i.push(complex(re, im))
+		return nil
+	}
+
+	i.opcodes["re"] = func(i *Interpreter) error {
+		val, err := i.popNumber()
+		if err != nil {
+			return err
+		}
+		if z, ok := val.(complex128); ok {
+			val = real(z)
+		}
+		i.push(val)
+		return nil
+	}
+
+	i.opcodes["im"] = func(i *Interpreter) error {
+		val, err := i.popNumber()
+		if err != nil {
+			return err
+		}
+		if z, ok := val.(complex128); ok {
+			i.push(imag(z))
+		} else {
+			i.push(newInt(0))
+		}
+		return nil
+	}
+
+	i.opcodes["conj"] = func(i *Interpreter) error {
+		val, err := i.popNumber()
+		if err != nil {
+			return err
+		}
+		if z, ok := val.(complex128); ok {
+			val = cmplx.Conj(z)
+		}
+		i.push(val)
+		return nil
+	}
+
+	i.opcodes["arg"] = func(i *Interpreter) error {
+		z, err := i.popComplex()
+		if err != nil {
+			return err
+		}
+		i.push(i.angleFromRadians(cmplx.Phase(z)))
+		return nil
+	}
+
+	// z ->polar, pushes the modulus and the argument
+	i.opcodes["->polar"] = func(i *Interpreter) error {
+		z, err := i.popComplex()
+		if err != nil {
+			return err
+		}
+		r, theta := cmplx.Polar(z)
+		i.push(r)
+		i.push(i.angleFromRadians(theta))
+		return nil
+	}
+
+	// r theta ->rect
+	i.opcodes["->rect"] = func(i *Interpreter) error {
+		theta, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		r, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		i.push(cmplx.Rect(r, i.angleToRadians(theta)))
+		return nil
+	}
+}
@@ -0,0 +1,320 @@
+package rpn
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// decimal is an exact decimal number, coef * 10^-scale, for the calculations
+// which must round like a human would (money...). The results of the arithmetic
+// words are rounded to _precision significant digits with the _rounding mode.
+type decimal struct {
+	coef  *big.Int
+	scale int // Number of digits after the decimal point, negative for multiples of 10
+}
+
+// defaultPrecision is the number of significant digits of the quotients when
+// _precision is 0.
+const defaultPrecision = 34
+
+// maxPrecision limits _precision, a division to millions of digits running
+// for minutes without any checkpoint to interrupt it.
+const maxPrecision = 10000
+
+// roundingModes lists the values of _rounding.
+var roundingModes = []string{"half-even", "half-up", "half-down", "up", "down", "ceiling", "floor"}
+
+// parseDecimal parses a decimal number such as 12, -0.5 or 19.99, without exponent.
+func parseDecimal(s string) (*decimal, bool) {
+	digits := s
+	if len(digits) > 0 && (digits[0] == '-' || digits[0] == '+') {
+		digits = digits[1:]
+	}
+	intPart, fracPart := digits, ""
+	if dot := strings.IndexByte(digits, '.'); dot >= 0 {
+		intPart, fracPart = digits[:dot], digits[dot+1:]
+	}
+	if len(intPart)+len(fracPart) == 0 {
+		return nil, false
+	}
+	for _, c := range intPart + fracPart {
+		if c < '0' || c > '9' {
+			return nil, false
+		}
+	}
+	coef, ok := new(big.Int).SetString(intPart+fracPart, 10)
+	if !ok {
+		return nil, false
+	}
+	if s[0] == '-' {
+		coef.Neg(coef)
+	}
+	return &decimal{coef: coef, scale: len(fracPart)}, true
+}
+
+// String formats a decimal with its digits after the decimal point, trailing
+// zeros included.
+func (d *decimal) String() string {
+	s := new(big.Int).Abs(d.coef).Text(10)
+	if d.scale <= 0 {
+		s += strings.Repeat("0", -d.scale)
+	} else {
+		if len(s) <= d.scale {
+			s = strings.Repeat("0", d.scale-len(s)+1) + s
+		}
+		s = s[:len(s)-d.scale] + "." + s[len(s)-d.scale:]
+	}
+	if d.coef.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// rat returns the exact value of a decimal as a fraction.
+func (d *decimal) rat() *big.Rat {
+	if d.scale <= 0 {
+		return new(big.Rat).SetInt(new(big.Int).Mul(d.coef, pow10(-d.scale)))
+	}
+	return new(big.Rat).SetFrac(d.coef, pow10(d.scale))
+}
+
+// withScale returns the coefficient of a decimal written with a larger scale.
+func (d *decimal) withScale(scale int) *big.Int {
+	return new(big.Int).Mul(d.coef, pow10(scale-d.scale))
+}
+
+// pow10 returns 10^n, n >= 0.
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// numDigits returns the number of decimal digits of an integer.
+func numDigits(n *big.Int) int {
+	if n.Sign() == 0 {
+		return 1
+	}
+	return len(new(big.Int).Abs(n).Text(10))
+}
+
+// roundQuo returns n/d rounded to an integer with a rounding mode, d being positive.
+func roundQuo(n, d *big.Int, mode string) *big.Int {
+	q, r := new(big.Int).QuoRem(n, d, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+	sign := n.Sign()
+	half := new(big.Int).Lsh(r.Abs(r), 1).Cmp(d) // Compares the remainder to d/2
+	var away bool
+	switch mode {
+	case "up":
+		away = true
+	case "down":
+		away = false
+	case "ceiling":
+		away = sign > 0
+	case "floor":
+		away = sign < 0
+	case "half-up":
+		away = half >= 0
+	case "half-down":
+		away = half > 0
+	default: // half-even
+		away = half > 0 || (half == 0 && q.Bit(0) == 1)
+	}
+	if away {
+		q.Add(q, big.NewInt(int64(sign)))
+	}
+	return q
+}
+
+// decimalContext returns the precision and the rounding mode of the decimal
+// arithmetic, 0 meaning no rounding. A larger precision read from a state file
+// is reduced to maxPrecision.
+func (i *Interpreter) decimalContext() (int, string) {
+	prec, _ := toFloat(i.variables["_precision"])
+	mode, _ := i.variables["_rounding"].(string)
+	return min(int(prec), maxPrecision), mode
+}
+
+// roundDecimal rounds a decimal to the precision of the decimal context.
+func (i *Interpreter) roundDecimal(d *decimal) *decimal {
+	prec, mode := i.decimalContext()
+	if prec < 1 {
+		return d
+	}
+	return roundDigits(d, prec, mode)
+}
+
+// roundDigits rounds a decimal to a number of significant digits.
+func roundDigits(d *decimal, prec int, mode string) *decimal {
+	drop := numDigits(d.coef) - prec
+	if drop <= 0 {
+		return d
+	}
+	coef := roundQuo(d.coef, pow10(drop), mode)
+	scale := d.scale - drop
+	if numDigits(coef) > prec { // 999 rounded up to 1000
+		coef.Quo(coef, big.NewInt(10))
+		scale--
+	}
+	return &decimal{coef: coef, scale: scale}
+}
+
+// quantize rounds a decimal to a number of digits after the decimal point,
+// adding trailing zeros if needed.
+func quantize(d *decimal, places int, mode string) *decimal {
+	if d.scale <= places {
+		return &decimal{coef: d.withScale(places), scale: places}
+	}
+	return &decimal{coef: roundQuo(d.coef, pow10(d.scale-places), mode), scale: places}
+}
+
+// ratToDecimal converts a fraction to a decimal of prec significant digits, the
+// trailing zeros after the decimal point being removed.
+func ratToDecimal(r *big.Rat, prec int, mode string) *decimal {
+	num, den := r.Num(), r.Denom()
+	// Scale giving prec digits before the decimal point to num * 10^scale / den
+	scale := prec - (numDigits(num) - numDigits(den))
+	for {
+		n, d := new(big.Int).Set(num), new(big.Int).Set(den)
+		if scale >= 0 {
+			n.Mul(n, pow10(scale))
+		} else {
+			d.Mul(d, pow10(-scale))
+		}
+		if q := new(big.Int).Quo(new(big.Int).Abs(n), d); q.Sign() != 0 && numDigits(q) > prec {
+			scale--
+			continue
+		} else if numDigits(q) < prec && q.Sign() != 0 {
+			scale++
+			continue
+		}
+		return trimDecimal(roundDigits(&decimal{coef: roundQuo(n, d, mode), scale: scale}, prec, mode))
+	}
+}
+
+// trimDecimal removes the trailing zeros after the decimal point.
+func trimDecimal(d *decimal) *decimal {
+	coef, scale := new(big.Int).Set(d.coef), d.scale
+	ten, r := big.NewInt(10), new(big.Int)
+	for scale > 0 && coef.Sign() != 0 {
+		q, _ := new(big.Int).QuoRem(coef, ten, r)
+		if r.Sign() != 0 {
+			break
+		}
+		coef, scale = q, scale-1
+	}
+	if coef.Sign() == 0 {
+		scale = 0
+	}
+	return &decimal{coef: coef, scale: scale}
+}
+
+// floatToDecimal converts a float64 to the decimal of its shortest representation.
+func floatToDecimal(f float64) (*decimal, bool) {
+	return parseDecimal(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+// toDecimal converts a number to a decimal, a fraction being rounded to the
+// decimal context.
+func (i *Interpreter) toDecimal(v interface{}) (*decimal, error) {
+	switch n := v.(type) {
+	case *decimal:
+		return n, nil
+	case *big.Int:
+		return &decimal{coef: n, scale: 0}, nil
+	case *big.Rat:
+		prec, mode := i.decimalContext()
+		if prec < 1 {
+			prec = defaultPrecision
+		}
+		return ratToDecimal(n, prec, mode), nil
+	case float64:
+		if d, ok := floatToDecimal(n); ok {
+			return d, nil
+		}
+		return nil, i.newError(81, n)
+	}
+	return nil, i.newError(3, TypeName(v))
+}
+
+// The arithmetic on decimals, rounded to the decimal context.
+
+func (i *Interpreter) addDecimals(a, b *decimal) *decimal {
+	scale := max(a.scale, b.scale)
+	return i.roundDecimal(&decimal{coef: new(big.Int).Add(a.withScale(scale), b.withScale(scale)), scale: scale})
+}
+
+func (i *Interpreter) subDecimals(a, b *decimal) *decimal {
+	scale := max(a.scale, b.scale)
+	return i.roundDecimal(&decimal{coef: new(big.Int).Sub(a.withScale(scale), b.withScale(scale)), scale: scale})
+}
+
+func (i *Interpreter) mulDecimals(a, b *decimal) *decimal {
+	return i.roundDecimal(&decimal{coef: new(big.Int).Mul(a.coef, b.coef), scale: a.scale + b.scale})
+}
+
+// divDecimals divides two decimals, b being non-zero. The quotient is exact if
+// it fits in the precision, and rounded to it otherwise.
+func (i *Interpreter) divDecimals(a, b *decimal) *decimal {
+	prec, mode := i.decimalContext()
+	if prec < 1 {
+		prec = defaultPrecision
+	}
+	return ratToDecimal(new(big.Rat).Quo(a.rat(), b.rat()), prec, mode)
+}
+
+// modDecimals returns the remainder of a truncated division, b being non-zero.
+func modDecimals(a, b *decimal) *decimal {
+	scale := max(a.scale, b.scale)
+	x, y := a.withScale(scale), b.withScale(scale)
+	return &decimal{coef: new(big.Int).Rem(x, y), scale: scale}
+}
+
+// truncDecimal returns the integer part of a decimal, as a decimal.
+func truncDecimal(d *decimal) *decimal {
+	if d.scale <= 0 {
+		return d
+	}
+	return &decimal{coef: new(big.Int).Quo(d.coef, pow10(d.scale)), scale: 0}
+}
+
+// compareDecimals compares two decimals, returning -1, 0 or 1.
+func compareDecimals(a, b *decimal) int {
+	scale := max(a.scale, b.scale)
+	return a.withScale(scale).Cmp(b.withScale(scale))
+}
+
+// roundNumber rounds a number to a number of digits after the decimal point
+// with the _rounding mode. Fractions are rounded to a decimal.
+func (i *Interpreter) roundNumber(v interface{}, places int) (interface{}, error) {
+	_, mode := i.decimalContext()
+	switch n := v.(type) {
+	case *big.Int:
+		if places >= 0 {
+			return n, nil
+		}
+		unit := pow10(-places)
+		return new(big.Int).Mul(roundQuo(n, unit, mode), unit), nil
+	case *big.Rat:
+		num := new(big.Int).Set(n.Num())
+		den := new(big.Int).Set(n.Denom())
+		if places >= 0 {
+			num.Mul(num, pow10(places))
+		} else {
+			den.Mul(den, pow10(-places))
+		}
+		return &decimal{coef: roundQuo(num, den, mode), scale: places}, nil
+	case float64:
+		d, err := i.toDecimal(n)
+		if err != nil {
+			return nil, err
+		}
+		f, _ := strconv.ParseFloat(quantize(d, places, mode).String(), 64)
+		return f, nil
+	case *decimal:
+		return quantize(n, places, mode), nil
+	}
+	return nil, i.newError(3, TypeName(v))
+}
@@ -0,0 +1,46 @@
+package rpn
+
+import "testing"
+
+func TestRoundingModes(t *testing.T) {
+	// Ties, values below and above the ties, both signs, and a quotient
+	const products = `2 "_precision" store 2.25d 1d * -2.25d 1d * 2.35d 1d * 2.21d 1d * 2.29d 1d * -2.29d 1d * 2d 3d /`
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{"half-even", "2.2 -2.2 2.4 2.2 2.3 -2.3 0.67"},
+		{"half-up", "2.3 -2.3 2.4 2.2 2.3 -2.3 0.67"},
+		{"half-down", "2.2 -2.2 2.3 2.2 2.3 -2.3 0.67"},
+		{"up", "2.3 -2.3 2.4 2.3 2.3 -2.3 0.67"},
+		{"down", "2.2 -2.2 2.3 2.2 2.2 -2.2 0.66"},
+		{"ceiling", "2.3 -2.2 2.4 2.3 2.3 -2.2 0.67"},
+		{"floor", "2.2 -2.3 2.3 2.2 2.2 -2.3 0.66"},
+	}
+	for _, test := range tests {
+		t.Run(test.mode, func(t *testing.T) {
+			source := `"` + test.mode + `" "_rounding" store ` + products
+			if got := evalStack(source, false); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPrecision(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{`0 "_precision" store 1.25d 1.25d *`, "1.5625"},
+		{`0 "_precision" store 1d 3d /`, "0.3333333333333333333333333333333333"},
+		{`3 "_precision" store 1234d 1d *`, "1230"},
+		{`10001 "_precision" store`, "error 103"},
+		{`2.5 "_precision" store`, "error 103"},
+	}
+	for _, test := range tests {
+		if got := evalStack(test.source, false); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.source, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package rpn
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// builtinDocs describes the built-in commands, for 'help <word>' and 'apropos'.
+var builtinDocs = map[string]Opcode{
+	// Parser
+	":":        {Effect: "( -- )", Category: "Parser", Help: "Starts the definition of a word, ended by ';'. A leading comment documents the word.", Examples: []string{": square ( n -- n*n ) dup * ;"}},
+	";":        {Effect: "( -- )", Category: "Parser", Help: "Ends the definition of a word."},
+	"(":        {Effect: "( -- )", Category: "Parser", Help: "Starts a comment, ended by ')'. Comments can be nested."},
+	")":        {Effect: "( -- )", Category: "Parser", Help: "Ends a comment."},
+	"{":        {Effect: "( -- block )", Category: "Parser", Help: "Starts a code block, ended by '}'.", Examples: []string{"{ 1 2 + } \"add\" store"}},
+	"}":        {Effect: "( -- )", Category: "Parser", Help: "Ends a code block."},
+	"[":        {Effect: "( -- mark )", Category: "Parser", Help: "Starts a list, ended by ']'. The code in between is run and the values it pushes are the elements.", Examples: []string{"[ 1 2 3 ]", "[ 1 2 + 4 ]  ( [ 3 4 ] )"}},
+	"]":        {Effect: "( mark x1 ... xn -- list )", Category: "Parser", Help: "Ends a list, collecting the values pushed since '['."},
+	"<<":       {Effect: "( -- mark )", Category: "Parser", Help: "Starts a map, ended by '>>'. The code in between pushes its keys and values.", Examples: []string{"<< \"name\" \"Bob\" \"id\" 42 >>"}},
+	">>":       {Effect: "( mark k1 v1 ... kn vn -- map )", Category: "Parser", Help: "Ends a map, collecting the keys and values pushed since '<<'."},
+	"|":        {Effect: "( -- mark )", Category: "Parser", Help: "Separates the rows of a matrix between '[' and ']'.", Examples: []string{"[| 1 2 | 3 4 |]", "[ 1 2 | 3 4 ]"}},
+	"\"":       {Effect: "( -- s )", Category: "Parser", Help: "Delimits a string literal.", Examples: []string{"\"Hello, World!\" ."}},
+	"delete":   {Effect: "( -- )", Category: "Parser", Help: "Deletes the following variable or word, optionally prefixed by 'var:' or 'word:'.", Examples: []string{"delete x", "delete word:greet"}},
+	"see":      {Effect: "( -- )", Category: "Parser", Help: "Displays the definition of the following variable or word.", Examples: []string{"see square"}},
+	"edit":     {Effect: "( -- )", Category: "Parser", Help: "Puts the definition of the following word or block variable into the input field.", Examples: []string{"edit square", "edit var:my_block"}},
+	"editfile": {Effect: "( -- )", Category: "Parser", Help: "Opens the following RPN file of ~/.polish in the editor.", Examples: []string{"editfile my_script"}},
+
+	// Arithmetic
+	"+":   {Effect: "( a b -- a+b )", Category: "Arithmetic", Help: "Adds two numbers or concatenates two strings.", Examples: []string{"10 5 +  ( 15 )", "\"foo\" \"bar\" +  ( \"foobar\" )"}},
+	"-":   {Effect: "( a b -- a-b )", Category: "Arithmetic", Help: "Subtracts b from a.", Examples: []string{"10 5 -  ( 5 )"}},
+	"*":   {Effect: "( a b -- a*b )", Category: "Arithmetic", Help: "Multiplies two numbers.", Examples: []string{"10 5 *  ( 50 )"}},
+	"/":   {Effect: "( a b -- a/b )", Category: "Arithmetic", Help: "Divides a by b. The quotient of two integers is an integer if the division is exact, otherwise a fraction in _exact mode.", Examples: []string{"10 5 /  ( 2 )"}},
+	"mod": {Effect: "( a b -- a%b )", Category: "Arithmetic", Help: "Remainder of the division of a by b, of the sign of a.", Examples: []string{"10 3 mod  ( 1 )"}},
+	"%":   {Effect: "( value total -- percent )", Category: "Arithmetic", Help: "Percentage of value relative to total.", Examples: []string{"25 200 %  ( 12.5 )"}},
+
+	// Conversions
+	"->frac":  {Effect: "( x -- a/b )", Category: "Arithmetic", Help: "Converts a number to an exact fraction, a float being approximated with a denominator up to _max_denominator.", Examples: []string{"0.75 ->frac  ( 3/4 )", "pi ->frac  ( 3126535/995207 )"}},
+	"->dec":   {Effect: "( x -- d )", Category: "Arithmetic", Help: "Converts a number to a decimal, rounded to _precision digits.", Examples: []string{"0.1 ->dec  ( 0.1 )", "1/4 ->dec  ( 0.25 )"}},
+	"->float": {Effect: "( x -- f )", Category: "Arithmetic", Help: "Converts a number to a floating-point number.", Examples: []string{"1/3 ->float  ( 0.3333333333333333 )"}},
+	"round":   {Effect: "( x n -- x' )", Category: "Arithmetic", Help: "Rounds x to n digits after the decimal point with the _rounding mode.", Examples: []string{"2.345d 2 round  ( 2.34 )", "12.5d 2 round  ( 12.50 )"}},
+
+	// Math
+	"abs":       {Effect: "( x -- |x| )", Category: "Math", Help: "Absolute value, modulus of a complex number."},
+	"chs":       {Effect: "( x -- -x )", Category: "Math", Help: "Changes the sign."},
+	"inv":       {Effect: "( x -- 1/x )", Category: "Math", Help: "Inverse, of a number or of a square matrix.", Examples: []string{"4 inv  ( 0.25 )", "[| 2 0 | 0 4 |] inv  ( [| 0.5 0 | 0 0.25 |] )"}},
+	"sqrt":      {Effect: "( x -- sqrt(x) )", Category: "Math", Help: "Square root, complex for a negative number in _complex mode.", Examples: []string{"16 sqrt  ( 4 )", "(3,4) sqrt  ( (2,1) )"}},
+	"sq":        {Effect: "( x -- x*x )", Category: "Math", Help: "Square."},
+	"pow":       {Effect: "( x y -- x^y )", Category: "Math", Help: "x to the power of y, exact for an integer raised to a non-negative integer and for a fraction raised to an integer.", Examples: []string{"2 10 pow  ( 1024 )"}},
+	"nroot":     {Effect: "( x n -- x^(1/n) )", Category: "Math", Help: "Nth root.", Examples: []string{"27 3 nroot  ( 3 )"}},
+	"exp":       {Effect: "( x -- e^x )", Category: "Math", Help: "Exponential."},
+	"ln":        {Effect: "( x -- ln(x) )", Category: "Math", Help: "Natural logarithm, complex for a negative number in _complex mode."},
+	"log":       {Effect: "( x -- log10(x) )", Category: "Math", Help: "Base 10 logarithm, complex for a negative number in _complex mode."},
+	"pow10":     {Effect: "( x -- 10^x )", Category: "Math", Help: "10 to the power of x."},
+	"factorial": {Effect: "( n -- n! )", Category: "Math", Help: "Factorial of a non-negative integer, exact for an integer.", Examples: []string{"5 factorial  ( 120 )", "25 factorial  ( 15511210043330985984000000 )"}},
+	"gamma":     {Effect: "( x -- gamma(x) )", Category: "Math", Help: "Gamma function."},
+	"int":       {Effect: "( x -- int(x) )", Category: "Math", Help: "Integer part."},
+	"frac":      {Effect: "( x -- frac(x) )", Category: "Math", Help: "Fractional part."},
+	"sin":       {Effect: "( x -- sin(x) )", Category: "Math", Help: "Sine, the angle unit depends on _degree_mode."},
+	"cos":       {Effect: "( x -- cos(x) )", Category: "Math", Help: "Cosine, the angle unit depends on _degree_mode."},
+	"tan":       {Effect: "( x -- tan(x) )", Category: "Math", Help: "Tangent, the angle unit depends on _degree_mode."},
+	"asin":      {Effect: "( x -- asin(x) )", Category: "Math", Help: "Arc sine, the angle unit depends on _degree_mode."},
+	"acos":      {Effect: "( x -- acos(x) )", Category: "Math", Help: "Arc cosine, the angle unit depends on _degree_mode."},
+	"atan":      {Effect: "( x -- atan(x) )", Category: "Math", Help: "Arc tangent, the angle unit depends on _degree_mode."},
+	"atan2":     {Effect: "( y x -- atan2(y,x) )", Category: "Math", Help: "Arc tangent of y/x, using the signs to find the quadrant."},
+	"pi":        {Effect: "( -- pi )", Category: "Math", Help: "Pushes the number pi."},
+	"e":         {Effect: "( -- e )", Category: "Math", Help: "Pushes the number e."},
+	"phi":       {Effect: "( -- phi )", Category: "Math", Help: "Pushes the golden ratio."},
+	"rand":      {Effect: "( -- x )", Category: "Math", Help: "Pushes a random number between 0 and 1."},
+
+	// Complex numbers
+	"->cx":    {Effect: "( re im -- z )", Category: "Complex", Help: "Makes a complex number from its real and imaginary parts.", Examples: []string{"3 4 ->cx  ( (3,4) )"}},
+	"re":      {Effect: "( z -- re )", Category: "Complex", Help: "Real part."},
+	"im":      {Effect: "( z -- im )", Category: "Complex", Help: "Imaginary part, 0 for a real number."},
+	"arg":     {Effect: "( z -- angle )", Category: "Complex", Help: "Argument, the angle unit depends on _degree_mode.", Examples: []string{"(0,1) arg  ( 1.5707963267948966 )"}},
+	"conj":    {Effect: "( z -- z' )", Category: "Complex", Help: "Complex conjugate.", Examples: []string{"(3,4) conj  ( (3,-4) )"}},
+	"->polar": {Effect: "( z -- r angle )", Category: "Complex", Help: "Converts to polar coordinates, the angle unit depends on _degree_mode.", Examples: []string{"(1,1) ->polar  ( 1.4142135623730951 0.7853981633974483 )"}},
+	"->rect":  {Effect: "( r angle -- z )", Category: "Complex", Help: "Converts from polar coordinates, the angle unit depends on _degree_mode.", Examples: []string{"2 0 ->rect  ( (2,0) )"}},
+
+	// Programmer
+	"band": {Effect: "( a b -- a&b )", Category: "Programmer", Help: "Bitwise AND of two integers.", Examples: []string{"0xF0 0x3C band  ( 48 )"}},
+	"bor":  {Effect: "( a b -- a|b )", Category: "Programmer", Help: "Bitwise OR of two integers.", Examples: []string{"0xF0 0x3C bor  ( 252 )"}},
+	"bxor": {Effect: "( a b -- a^b )", Category: "Programmer", Help: "Bitwise exclusive OR of two integers.", Examples: []string{"0xF0 0x3C bxor  ( 204 )"}},
+	"bnot": {Effect: "( a -- ~a )", Category: "Programmer", Help: "Bitwise complement of an integer.", Examples: []string{"5 bnot  ( -6 )"}},
+	"shl":  {Effect: "( a n -- a' )", Category: "Programmer", Help: "Shifts an integer n bits to the left, wrapped to _word_size.", Examples: []string{"1 10 shl  ( 1024 )"}},
+	"shr":  {Effect: "( a n -- a' )", Category: "Programmer", Help: "Shifts an integer n bits to the right, keeping the sign of a signed integer.", Examples: []string{"-16 2 shr  ( -4 )"}},
+	"rol":  {Effect: "( a n -- a' )", Category: "Programmer", Help: "Rotates the _word_size bits of an integer n bits to the left.", Examples: []string{"8 \"_word_size\" store 0x81 1 rol  ( 3 )"}},
+	"ror":  {Effect: "( a n -- a' )", Category: "Programmer", Help: "Rotates the _word_size bits of an integer n bits to the right.", Examples: []string{"8 \"_word_size\" store \"_signed\" unset 0x81 1 ror  ( 192 )"}},
+	"hex":  {Effect: "( -- )", Category: "Programmer", Help: "Displays the integers in hexadecimal.", Examples: []string{"hex 255  ( 0xFF )"}},
+	"dec":  {Effect: "( -- )", Category: "Programmer", Help: "Displays the integers in decimal."},
+	"oct":  {Effect: "( -- )", Category: "Programmer", Help: "Displays the integers in octal.", Examples: []string{"oct 8  ( 0o10 )"}},
+	"bin":  {Effect: "( -- )", Category: "Programmer", Help: "Displays the integers in binary.", Examples: []string{"bin 5  ( 0b101 )"}},
+
+	// Stack
+	"dup":   {Effect: "( a -- a a )", Category: "Stack", Help: "Duplicates the top item on the stack.", Examples: []string{"1 2 dup  ( Stack: 1 2 2 )"}},
+	"drop":  {Effect: "( a -- )", Category: "Stack", Help: "Removes the top item from the stack.", Examples: []string{"1 2 drop  ( Stack: 1 )"}},
+	"swap":  {Effect: "( a b -- b a )", Category: "Stack", Help: "Swaps the top two items on the stack.", Examples: []string{"1 2 swap  ( Stack: 2 1 )"}},
+	"rot":   {Effect: "( a b c -- b c a )", Category: "Stack", Help: "Rotates the top three items on the stack.", Examples: []string{"1 2 3 rot  ( Stack: 2 3 1 )"}},
+	"clear": {Effect: "( ... -- )", Category: "Stack", Help: "Clears the entire stack."},
+	"depth": {Effect: "( -- n )", Category: "Stack", Help: "Pushes the current stack depth.", Examples: []string{"1 2 3 depth  ( Stack: 1 2 3 3 )"}},
+
+	// Comparison and logic
+	"==":    {Effect: "( a b -- bool )", Category: "Comparison", Help: "True if a equals b."},
+	"!=":    {Effect: "( a b -- bool )", Category: "Comparison", Help: "True if a differs from b."},
+	"<":     {Effect: "( a b -- bool )", Category: "Comparison", Help: "True if a is less than b, strings being compared in lexicographic order."},
+	"<=":    {Effect: "( a b -- bool )", Category: "Comparison", Help: "True if a is less than or equal to b, strings being compared in lexicographic order."},
+	">":     {Effect: "( a b -- bool )", Category: "Comparison", Help: "True if a is greater than b, strings being compared in lexicographic order."},
+	">=":    {Effect: "( a b -- bool )", Category: "Comparison", Help: "True if a is greater than or equal to b, strings being compared in lexicographic order."},
+	"true":  {Effect: "( -- true )", Category: "Logic", Help: "Pushes the boolean true."},
+	"false": {Effect: "( -- false )", Category: "Logic", Help: "Pushes the boolean false."},
+	"and":   {Effect: "( a b -- a&&b )", Category: "Logic", Help: "Logical and."},
+	"or":    {Effect: "( a b -- a||b )", Category: "Logic", Help: "Logical or."},
+	"xor":   {Effect: "( a b -- a^^b )", Category: "Logic", Help: "Logical exclusive or."},
+	"not":   {Effect: "( a -- !a )", Category: "Logic", Help: "Logical not."},
+
+	// Control flow
+	"if":       {Effect: "( cond {then} [{else}] -- )", Category: "Control", Help: "Executes the then block if the condition is true, the optional else block otherwise.", Examples: []string{"true { \"yes\" . } { \"no\" . } if"}},
+	"loop":     {Effect: "( n {block} -- )", Category: "Control", Help: "Executes the block n times, 'index' gives the current iteration.", Examples: []string{"3 { index . cr } loop"}},
+	"for":      {Effect: "( start end step {block} -- )", Category: "Control", Help: "Executes the block for each value from start to end included, 'index' gives the current value.", Examples: []string{"1 10 2 { index . \" \" . } for  ( 1 3 5 7 9 )", "1 0 -0.25 { i . \" \" . } for  ( 1 0.75 0.5 0.25 0 )"}},
+	"xfor":     {Effect: "( start end step {block} -- )", Category: "Control", Help: "Same as 'for', the end value being excluded.", Examples: []string{"0 5 1 { i . } xfor  ( 01234 )"}},
+	"while":    {Effect: "( {cond} {body} -- )", Category: "Control", Help: "Executes the body as long as the condition block leaves true or a non-zero number on the stack."},
+	"break":    {Effect: "( -- )", Category: "Control", Help: "Exits the current 'loop', 'while' or 'for'."},
+	"continue": {Effect: "( -- )", Category: "Control", Help: "Skips to the next iteration of the current 'loop', 'while' or 'for'."},
+	"index":    {Effect: "( -- n )", Category: "Control", Help: "Pushes the index of the innermost loop (0-based), same as 'i'."},
+	"i":        {Effect: "( -- n )", Category: "Control", Help: "Pushes the index of the innermost 'loop' or 'while' (0-based)."},
+	"j":        {Effect: "( -- n )", Category: "Control", Help: "Pushes the index of the loop enclosing the innermost one.", Examples: []string{"3 { 2 { j . \",\" . i . cr } loop } loop"}},
+	"k":        {Effect: "( -- n )", Category: "Control", Help: "Pushes the index of the third enclosing loop."},
+	"leave":    {Effect: "( level -- )", Category: "Control", Help: "Exits the loop given by its level (0 for the innermost) or its counter name (\"i\", \"j\", \"k\"), and the loops nested into it.", Examples: []string{"3 { 3 { i 1 == { \"j\" leave } if i . } loop } loop"}},
+
+	// Errors
+	"try":     {Effect: "( {body} {handler} -- )", Category: "Errors", Help: "Executes the body. If it fails, the handler is executed with the error code and message on the stack.", Examples: []string{"{ 1 0 / } { \"error \" . swap . \": \" . . cr } try"}},
+	"finally": {Effect: "( {body} {handler} {cleanup} -- )", Category: "Errors", Help: "Same as 'try', the cleanup block being executed in any case.", Examples: []string{"{ \"data\" import } { drop drop } { \"done\" . cr } finally"}},
+	"catch":   {Effect: "( {body} -- code )", Category: "Errors", Help: "Executes the body and pushes the code of its error, or 0 if it succeeded.", Examples: []string{"{ 1 0 / } catch  ( 2 )"}},
+	"throw":   {Effect: "( code message -- )", Category: "Errors", Help: "Raises an error with the given code and message, which can be caught by 'try'.", Examples: []string{"1000 \"invalid invoice\" throw"}},
+
+	// Variables
+	"store":  {Effect: "( value name -- )", Category: "Variables", Help: "Stores the value into the variable, local to the word if the name starts with '$'.", Examples: []string{"10 \"x\" store"}},
+	"load":   {Effect: "( name -- value )", Category: "Variables", Help: "Pushes the value of the variable.", Examples: []string{"\"x\" load"}},
+	"set":    {Effect: "( name -- )", Category: "Variables", Help: "Sets the variable to true.", Examples: []string{"\"_degree_mode\" set"}},
+	"unset":  {Effect: "( name -- )", Category: "Variables", Help: "Sets the variable to false.", Examples: []string{"\"_degree_mode\" unset"}},
+	"toggle": {Effect: "( name -- )", Category: "Variables", Help: "Toggles a boolean variable.", Examples: []string{"\"_echo_mode\" toggle"}},
+	"free":   {Effect: "( -- )", Category: "Variables", Help: "Deletes all the user-defined variables."},
+	"forget": {Effect: "( -- )", Category: "Words", Help: "Deletes all the user-defined words."},
+
+	// Lists
+	"->list":  {Effect: "( x1 ... xn n -- list )", Category: "Lists", Help: "Collects n values into a list.", Examples: []string{"1 2 3 3 ->list  ( [ 1 2 3 ] )"}},
+	"list->":  {Effect: "( list -- x1 ... xn n )", Category: "Lists", Help: "Pushes the elements of a list, then their number.", Examples: []string{"[ 1 2 ] list->  ( Stack: 1 2 2 )"}},
+	"length":  {Effect: "( list -- n )", Category: "Lists", Help: "Number of elements of a list or a map, or number of characters of a string.", Examples: []string{"[ 1 2 3 ] length  ( 3 )"}},
+	"nth":     {Effect: "( list n -- x )", Category: "Lists", Help: "Element at index n, from 0.", Examples: []string{"[ 10 20 30 ] 1 nth  ( 20 )"}},
+	"append":  {Effect: "( list x -- list' )", Category: "Lists", Help: "Adds a value at the end of a list.", Examples: []string{"[ 1 2 ] 3 append  ( [ 1 2 3 ] )"}},
+	"concat":  {Effect: "( list1 list2 -- list )", Category: "Lists", Help: "Concatenates two lists.", Examples: []string{"[ 1 ] [ 2 3 ] concat  ( [ 1 2 3 ] )"}},
+	"slice":   {Effect: "( list start end -- list' )", Category: "Lists", Help: "Elements from index start to end, excluded.", Examples: []string{"[ 1 2 3 4 ] 1 3 slice  ( [ 2 3 ] )"}},
+	"reverse": {Effect: "( list -- list' )", Category: "Lists", Help: "Reverses the order of the elements, or of the characters of a string.", Examples: []string{"[ 1 2 3 ] reverse  ( [ 3 2 1 ] )"}},
+	"sort":    {Effect: "( list -- list' )", Category: "Lists", Help: "Sorts a list of real numbers or of strings in ascending order.", Examples: []string{"[ 3 1 2 ] sort  ( [ 1 2 3 ] )"}},
+	"map":     {Effect: "( list {block} -- list' )", Category: "Lists", Help: "Runs the block on each element, and collects the results.", Examples: []string{"[ 1 2 3 ] { dup * } map  ( [ 1 4 9 ] )"}},
+	"filter":  {Effect: "( list {block} -- list' )", Category: "Lists", Help: "Keeps the elements for which the block returns true.", Examples: []string{"[ 1 2 3 4 ] { 2 mod 0 == } filter  ( [ 2 4 ] )"}},
+	"reduce":  {Effect: "( list {block} -- x )", Category: "Lists", Help: "Combines the elements with the block, starting from the first one.", Examples: []string{"[ 1 2 3 4 ] { + } reduce  ( 10 )"}},
+	"fold":    {Effect: "( list initial {block} -- x )", Category: "Lists", Help: "Combines the elements with the block, starting from the initial value.", Examples: []string{"[ 1 2 3 ] 10 { * } fold  ( 60 )"}},
+	"each":    {Effect: "( list {block} -- )", Category: "Lists", Help: "Runs the block on each element, or on the key and the value of each entry of a map, as a loop.", Examples: []string{"[ 1 2 3 ] { . cr } each", "<< \"a\" 1 >> { . \"=\" . . } each  ( 1=a )"}},
+
+	// Maps
+	"get":    {Effect: "( map key -- value )", Category: "Maps", Help: "Value of a key.", Examples: []string{"<< \"id\" 42 >> \"id\" get  ( 42 )"}},
+	"put":    {Effect: "( map key value -- map' )", Category: "Maps", Help: "Sets the value of a key.", Examples: []string{"<< >> \"id\" 42 put  ( << \"id\" 42 >> )"}},
+	"has":    {Effect: "( map key -- bool )", Category: "Maps", Help: "Tells if a map has a key."},
+	"remove": {Effect: "( map key -- map' )", Category: "Maps", Help: "Removes a key from a map."},
+	"keys":   {Effect: "( map -- list )", Category: "Maps", Help: "Keys of a map, in ascending order.", Examples: []string{"<< \"b\" 2 \"a\" 1 >> keys  ( [ \"a\" \"b\" ] )"}},
+	"values": {Effect: "( map -- list )", Category: "Maps", Help: "Values of a map, in the order of the keys.", Examples: []string{"<< \"b\" 2 \"a\" 1 >> values  ( [ 1 2 ] )"}},
+
+	// Matrices
+	"->matrix":  {Effect: "( list -- matrix )", Category: "Matrices", Help: "Converts a list of rows, or a list of numbers, to a matrix.", Examples: []string{"[ [ 1 2 ] [ 3 4 ] ] ->matrix  ( [| 1 2 | 3 4 |] )"}},
+	"identity":  {Effect: "( n -- matrix )", Category: "Matrices", Help: "Identity matrix of size n.", Examples: []string{"2 identity  ( [| 1 0 | 0 1 |] )"}},
+	"zeros":     {Effect: "( rows cols -- matrix )", Category: "Matrices", Help: "Matrix of zeros.", Examples: []string{"2 3 zeros  ( [| 0 0 0 | 0 0 0 |] )"}},
+	"dims":      {Effect: "( matrix -- rows cols )", Category: "Matrices", Help: "Number of rows and columns of a matrix."},
+	"elem":      {Effect: "( matrix row col -- x )", Category: "Matrices", Help: "Element of a matrix, the indices starting from 0.", Examples: []string{"[| 1 2 | 3 4 |] 1 0 elem  ( 3 )"}},
+	"transpose": {Effect: "( matrix -- matrix' )", Category: "Matrices", Help: "Transpose of a matrix.", Examples: []string{"[| 1 2 3 |] transpose  ( [| 1 | 2 | 3 |] )"}},
+	"det":       {Effect: "( matrix -- x )", Category: "Matrices", Help: "Determinant of a square matrix.", Examples: []string{"[| 1 2 | 3 4 |] det  ( -2 )"}},
+	"solve":     {Effect: "( A b -- x )", Category: "Matrices", Help: "Solves the linear system A x = b, b having a column by right-hand side.", Examples: []string{"[| 2 1 | 1 3 |] [| 3 | 5 |] solve  ( [| 0.8 | 1.4 |] )"}},
+	"dot":       {Effect: "( u v -- x )", Category: "Matrices", Help: "Dot product of two vectors.", Examples: []string{"[| 1 2 3 |] [| 4 5 6 |] dot  ( 32 )"}},
+	"cross":     {Effect: "( u v -- w )", Category: "Matrices", Help: "Cross product of two vectors of 3 elements.", Examples: []string{"[| 1 0 0 |] [| 0 1 0 |] cross  ( [| 0 0 1 |] )"}},
+	"norm":      {Effect: "( matrix -- x )", Category: "Matrices", Help: "Euclidean norm of a vector, Frobenius norm of a matrix.", Examples: []string{"[| 3 4 |] norm  ( 5 )"}},
+	"rnorm":     {Effect: "( matrix -- x )", Category: "Matrices", Help: "Row norm, the largest sum of the absolute values of a row."},
+	"cnorm":     {Effect: "( matrix -- x )", Category: "Matrices", Help: "Column norm, the largest sum of the absolute values of a column."},
+
+	// Strings
+	"len":         {Effect: "( s -- n )", Category: "Strings", Help: "Number of characters of the string, an accented letter counting as one character.", Examples: []string{"\"héllo\" len  ( 5 )"}},
+	"bytelen":     {Effect: "( s -- n )", Category: "Strings", Help: "Size of the string in bytes, encoded in UTF-8.", Examples: []string{"\"héllo\" bytelen  ( 6 )"}},
+	"mid":         {Effect: "( s start length -- s' )", Category: "Strings", Help: "Extracts a substring, a negative start counting from the end of the string.", Examples: []string{"\"world\" 1 3 mid  ( \"orl\" )", "\"world\" -3 2 mid  ( \"rl\" )"}},
+	"chars":       {Effect: "( s -- list )", Category: "Strings", Help: "Splits the string into a list of its characters.", Examples: []string{"\"abc\" chars  ( [ \"a\" \"b\" \"c\" ] )"}},
+	"find":        {Effect: "( s sub -- n )", Category: "Strings", Help: "Position of the first occurrence of sub in s, or -1.", Examples: []string{"\"banana\" \"an\" find  ( 1 )"}},
+	"rfind":       {Effect: "( s sub -- n )", Category: "Strings", Help: "Position of the last occurrence of sub in s, or -1.", Examples: []string{"\"banana\" \"an\" rfind  ( 3 )"}},
+	"contains":    {Effect: "( s sub -- bool )", Category: "Strings", Help: "True if sub occurs in s."},
+	"startswith":  {Effect: "( s prefix -- bool )", Category: "Strings", Help: "True if s starts with prefix."},
+	"endswith":    {Effect: "( s suffix -- bool )", Category: "Strings", Help: "True if s ends with suffix."},
+	"replace":     {Effect: "( s old new -- s' )", Category: "Strings", Help: "Replaces the first occurrence of old by new.", Examples: []string{"\"banana\" \"a\" \"o\" replace  ( \"bonana\" )"}},
+	"replace-all": {Effect: "( s old new -- s' )", Category: "Strings", Help: "Replaces all the occurrences of old by new.", Examples: []string{"\"banana\" \"a\" \"o\" replace-all  ( \"bonono\" )"}},
+	"split":       {Effect: "( s sep -- s1 ... sn n )", Category: "Strings", Help: "Splits s around the occurrences of sep, or into its characters if sep is empty, and pushes the pieces and their number.", Examples: []string{"\"a,b,c\" \",\" split  ( Stack: \"a\" \"b\" \"c\" 3 )"}},
+	"join":        {Effect: "( s1 ... sn n sep -- s )", Category: "Strings", Help: "Joins n strings, or the strings of a list, with sep between them.", Examples: []string{"\"a\" \"b\" \"c\" 3 \"-\" join  ( \"a-b-c\" )", "[ \"x\" \"y\" ] \", \" join  ( \"x, y\" )"}},
+	"trim":        {Effect: "( s -- s' )", Category: "Strings", Help: "Removes the spaces at both ends of the string."},
+	"ltrim":       {Effect: "( s -- s' )", Category: "Strings", Help: "Removes the spaces at the start of the string."},
+	"rtrim":       {Effect: "( s -- s' )", Category: "Strings", Help: "Removes the spaces at the end of the string."},
+	"left":        {Effect: "( s n -- s' )", Category: "Strings", Help: "The first n characters of the string.", Examples: []string{"\"hello\" 2 left  ( \"he\" )"}},
+	"right":       {Effect: "( s n -- s' )", Category: "Strings", Help: "The last n characters of the string.", Examples: []string{"\"hello\" 3 right  ( \"llo\" )"}},
+	"repeat":      {Effect: "( s n -- s' )", Category: "Strings", Help: "Repeats the string n times.", Examples: []string{"\"ab\" 3 repeat  ( \"ababab\" )"}},
+	"lpad":        {Effect: "( s width pad -- s' )", Category: "Strings", Help: "Adds the character pad on the left until the string has width characters.", Examples: []string{"\"42\" 5 \"0\" lpad  ( \"00042\" )"}},
+	"rpad":        {Effect: "( s width pad -- s' )", Category: "Strings", Help: "Adds the character pad on the right until the string has width characters.", Examples: []string{"\"42\" 5 \".\" rpad  ( \"42...\" )"}},
+	"upper":       {Effect: "( s -- S )", Category: "Strings", Help: "Converts the string to uppercase."},
+	"lower":       {Effect: "( S -- s )", Category: "Strings", Help: "Converts the string to lowercase."},
+	"val":         {Effect: "( s -- value )", Category: "Strings", Help: "Converts a string to a number or a boolean, if possible.", Examples: []string{"\"123\" val  ( 123 )"}},
+	"str":         {Effect: "( value -- s )", Category: "Strings", Help: "Converts any value to its string representation."},
+	"code":        {Effect: "( s -- n )", Category: "Strings", Help: "Pushes the Unicode code point of the first character.", Examples: []string{"\"A\" code  ( 65 )"}},
+	"char":        {Effect: "( n -- s )", Category: "Strings", Help: "Pushes the character having this Unicode code point.", Examples: []string{"65 char  ( \"A\" )"}},
+
+	// Input/Output
+	".":      {Effect: "( a -- )", Category: "I/O", Help: "Prints the value on top of the stack, a matrix with one line by row."},
+	"print":  {Effect: "( a -- )", Category: "I/O", Help: "Same as '.'."},
+	"cr":     {Effect: "( -- )", Category: "I/O", Help: "Prints a new line."},
+	"emit":   {Effect: "( n -- )", Category: "I/O", Help: "Prints the character having this Unicode code point.", Examples: []string{"65 emit  ( A )"}},
+	"cls":    {Effect: "( -- )", Category: "I/O", Help: "Clears the output."},
+	"prompt": {Effect: "( message -- s )", Category: "I/O", Help: "Displays the message and waits for an input.", Examples: []string{"\"Your name?\" prompt"}},
+
+	// Files
+	"save":    {Effect: "( filename -- )", Category: "Files", Help: "Saves the stack, variables and words to a JSON file of ~/.polish.", Examples: []string{"\"mystate\" save"}},
+	"restore": {Effect: "( filename -- )", Category: "Files", Help: "Restores the state saved in a JSON file of ~/.polish.", Examples: []string{"\"mystate\" restore"}},
+	"import":  {Effect: "( filename -- )", Category: "Files", Help: "Executes an RPN file of ~/.polish, then its 'main' word if it defines one.", Examples: []string{"\"test\" import"}},
+	"export":  {Effect: "( word filename -- )", Category: "Files", Help: "Appends the definition of a word to an RPN file of ~/.polish.", Examples: []string{"\"square\" \"mywords\" export"}},
+	"list":    {Effect: "( -- )", Category: "Files", Help: "Lists the RPN files of ~/.polish."},
+
+	// Time
+	"time":   {Effect: "( -- s )", Category: "Time", Help: "Pushes the current time as HH:MM:SS."},
+	"date":   {Effect: "( -- s )", Category: "Time", Help: "Pushes the current date as YYYY-MM-DD."},
+	"year":   {Effect: "( -- n )", Category: "Time", Help: "Pushes the current year."},
+	"month":  {Effect: "( -- n )", Category: "Time", Help: "Pushes the current month."},
+	"day":    {Effect: "( -- n )", Category: "Time", Help: "Pushes the current day of the month."},
+	"hour":   {Effect: "( -- n )", Category: "Time", Help: "Pushes the current hour."},
+	"minute": {Effect: "( -- n )", Category: "Time", Help: "Pushes the current minute."},
+	"second": {Effect: "( -- n )", Category: "Time", Help: "Pushes the current second."},
+
+	// Interpreter
+	"words":   {Effect: "( -- )", Category: "Interpreter", Help: "Lists the commands, words and variables."},
+	"help":    {Effect: "( [name] -- )", Category: "Interpreter", Help: "Displays the help of a command, word or variable, or the whole help without argument.", Examples: []string{"help swap", "\"swap\" help"}},
+	"apropos": {Effect: "( s -- )", Category: "Interpreter", Help: "Lists the commands and words whose description contains the string.", Examples: []string{"\"string\" apropos"}},
+	"undo":    {Effect: "( -- )", Category: "Interpreter", Help: "Restores the stack, variables and words as they were before the last command line.", Examples: []string{"1 2 +", "undo  ( the stack holds 1 2 again )"}},
+	"redo":    {Effect: "( -- )", Category: "Interpreter", Help: "Restores the state undone by the last 'undo'."},
+	"undos":   {Effect: "( -- )", Category: "Interpreter", Help: "Lists the command lines which can be undone, the next one first, and the ones which can be redone."},
+	"exit":    {Effect: "( -- )", Category: "Interpreter", Help: "Exits the interpreter."},
+	"quit":    {Effect: "( -- )", Category: "Interpreter", Help: "Same as 'exit'."},
+	"bye":     {Effect: "( -- )", Category: "Interpreter", Help: "Same as 'exit'."},
+}
+
+// describe returns the description of a command or a user-defined word.
+func (i *Interpreter) describe(name string) (Opcode, bool) {
+	if op, ok := i.registered[name]; ok {
+		return op, true
+	}
+	if op, ok := builtinDocs[name]; ok {
+		op.Name = name
+		return op, true
+	}
+	if def, ok := i.words[name]; ok {
+		op := Opcode{Name: name, Category: "Word"}
+		doc := wordDoc(def)
+		if strings.Contains(doc, "--") {
+			op.Effect = "( " + doc + " )"
+		} else {
+			op.Help = doc
+		}
+		return op, true
+	}
+	return Opcode{}, false
+}
+
+// wordDoc returns the content of the comment starting a word definition, if any.
+func wordDoc(def []string) string {
+	if len(def) == 0 || def[0] != "(" {
+		return ""
+	}
+	level := 0
+	for k, token := range def {
+		if token == "(" {
+			level++
+		} else if token == ")" {
+			level--
+			if level == 0 {
+				return strings.Join(def[1:k], " ")
+			}
+		}
+	}
+	return ""
+}
+
+// writeDescription writes the help of a command, a word or a variable.
+func (i *Interpreter) writeDescription(w io.Writer, name string) error {
+	if op, ok := i.describe(name); ok {
+		header := op.Name
+		if op.Effect != "" {
+			header += " " + op.Effect
+		}
+		fmt.Fprintf(w, "%s  <%s>\n", header, op.Category)
+		if op.Help != "" {
+			fmt.Fprintf(w, "  %s\n", op.Help)
+		}
+		if def, ok := i.words[name]; ok {
+			fmt.Fprintf(w, "  : %s %s ;\n", name, strings.Join(def, " "))
+		}
+		for _, example := range op.Examples {
+			fmt.Fprintf(w, "  Example: %s\n", example)
+		}
+		return nil
+	}
+	if val, ok := i.variables[name]; ok {
+		fmt.Fprintf(w, "%s  <Variable>\n  %s: %s\n", name, TypeName(val), i.Format(val))
+		return nil
+	}
+	return i.newError(21, name)
+}
+
+// isDescribed tells if help is available for the given name.
+func (i *Interpreter) isDescribed(name string) bool {
+	if _, ok := i.describe(name); ok {
+		return true
+	}
+	_, ok := i.variables[name]
+	return ok
+}
+
+// helpOnStack tells if 'help' takes the name to describe from the stack, which
+// it does when a string is on top of it.
+func (i *Interpreter) helpOnStack() bool {
+	if len(i.stack) == 0 {
+		return false
+	}
+	_, ok := i.stack[len(i.stack)-1].(string)
+	return ok
+}
+
+// apropos lists the commands and words whose name or description contains the given string.
+func (i *Interpreter) apropos(w io.Writer, search string) {
+	search = strings.ToLower(search)
+	var names []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		op, _ := i.describe(name)
+		text := strings.ToLower(op.Name + " " + op.Effect + " " + op.Category + " " + op.Help)
+		if strings.Contains(text, search) {
+			names = append(names, name)
+		}
+	}
+	for name := range i.registered {
+		add(name)
+	}
+	for name := range builtinDocs {
+		add(name)
+	}
+	for name := range i.words {
+		add(name)
+	}
+	sort.Strings(names)
+
+	if len(names) == 0 {
+		fmt.Fprintln(w, "(Nothing appropriate)")
+		return
+	}
+	for _, name := range names {
+		op, _ := i.describe(name)
+		fmt.Fprintf(w, "%s %s: %s\n", op.Name, op.Effect, op.Help)
+	}
+}
@@ -0,0 +1,254 @@
+package rpn
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrBreak, ErrContinue and ErrExit are returned by the 'break', 'continue' and 'exit' words.
+var ErrBreak = fmt.Errorf("break")
+var ErrContinue = fmt.Errorf("continue")
+var ErrExit = fmt.Errorf("exit")
+
+// PolishError is the error returned by the interpreter. It can be inspected with
+// errors.As, and compared to the sentinel errors below with errors.Is.
+type PolishError struct {
+	Code    int     // Error code, as listed in errorDefs
+	Message string  // Error message, without the code
+	Token   string  // Token being executed when the error occurred
+	Pos     Pos     // Position of the token in its source, if known
+	Chain   []Frame // Words and variables being executed, the innermost first
+	Err     error   // Underlying error (file system...), if any
+}
+
+// Frame is an element of the call chain of an error.
+type Frame struct {
+	Kind string // "word" or "variable"
+	Name string
+	Pos  Pos // Position of the call, if known
+}
+
+// Error returns the code and the message of the error, as plain text.
+func (e *PolishError) Error() string {
+	return fmt.Sprintf("error %d: %s", e.Code, e.Message)
+}
+
+// Traceback returns the failing token and the call chain, one line per element,
+// with their position in the source when it is known. Identical consecutive
+// frames, as in a recursion, are given once with their count.
+func (e *PolishError) Traceback() []string {
+	var lines []string
+	if e.Token != "" {
+		line := fmt.Sprintf("at '%s'", e.Token)
+		if e.Pos.IsValid() {
+			line += " (" + e.Pos.String() + ")"
+		}
+		lines = append(lines, line)
+	}
+	for k := 0; k < len(e.Chain); {
+		frame := e.Chain[k]
+		line := fmt.Sprintf("in %s '%s'", frame.Kind, frame.Name)
+		if frame.Pos.IsValid() {
+			line += ", called at " + frame.Pos.String()
+		}
+		repeated := 1
+		for k+repeated < len(e.Chain) && e.Chain[k+repeated] == frame {
+			repeated++
+		}
+		if repeated > 1 {
+			line += fmt.Sprintf(" (%d times)", repeated)
+		}
+		lines = append(lines, line)
+		k += repeated
+	}
+	return lines
+}
+
+// Unwrap returns the underlying error.
+func (e *PolishError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is a PolishError with the same code.
+func (e *PolishError) Is(target error) bool {
+	t, ok := target.(*PolishError)
+	return ok && t.Code == e.Code
+}
+
+// Sentinel errors, to be used with errors.Is.
+var (
+	ErrStackUnderflow  = &PolishError{Code: 1, Message: "stack underflow"}
+	ErrDivisionByZero  = &PolishError{Code: 2, Message: "division by zero"}
+	ErrUndefined       = &PolishError{Code: 15, Message: "undefined variable"}
+	ErrUnrecognized    = &PolishError{Code: 34, Message: "unrecognized token"}
+	ErrInterrupted     = &PolishError{Code: 51, Message: "execution interrupted by user"}
+	ErrTimeout         = &PolishError{Code: 70, Message: "execution timed out"}
+	ErrNotInteractive  = &PolishError{Code: 60, Message: "not available without an interactive front-end"}
+	ErrOpcodeConflicts = &PolishError{Code: 62, Message: "opcode name conflicts with an existing command, word or variable"}
+	ErrSandboxed       = &PolishError{Code: 76, Message: "not allowed in sandbox mode"}
+)
+
+// errorDef defines the message of an error code.
+type errorDef struct {
+	Code    int
+	Message string
+}
+
+// Predefined errors
+var errorDefs = []errorDef{
+	{Code: 1, Message: "stack underflow"},
+	{Code: 2, Message: "division by zero"},
+	{Code: 3, Message: "type error: expected a number, got %s"},
+	{Code: 4, Message: "type error: expected a boolean, got %s"},
+	{Code: 5, Message: "type error: expected a string, got %s"},
+	{Code: 6, Message: "type error: expected a code block, got %s"},
+	{Code: 7, Message: "type error: '+' requires two numbers or two strings, got %s and %s"},
+	{Code: 8, Message: "type error: '+' requires two numbers or two strings, got %s"},
+	{Code: 9, Message: "invalid arguments for if"},
+	{Code: 10, Message: "%s: not inside a loop"},
+	{Code: 11, Message: "variable name '%s' conflicts with an existing command"},
+	{Code: 12, Message: "variable names starting with '_' are reserved for internal use: %s"},
+	{Code: 13, Message: "internal variable %s can only be set to a boolean value"},
+	{Code: 14, Message: "cannot modify internal variable: %s"},
+	{Code: 15, Message: "undefined variable: %s"},
+	{Code: 16, Message: "invalid function definition"},
+	{Code: 17, Message: "word names starting with '_' are reserved for internal use: %s"},
+	{Code: 18, Message: "word name '%s' conflicts with an existing command"},
+	{Code: 19, Message: "delete: missing variable or word name"},
+	{Code: 20, Message: "cannot delete internal variable or word: %s"},
+	{Code: 21, Message: "undefined variable or word: %s"},
+	{Code: 22, Message: "undefined %s: %s"},
+	{Code: 23, Message: "see: missing variable or word name"},
+	{Code: 24, Message: "edit: missing name"},
+	{Code: 25, Message: "edit: undefined word or variable: %s"},
+	{Code: 26, Message: "edit: word '%s' not found"},
+	{Code: 27, Message: "edit: variable '%s' is not a code block"},
+	{Code: 28, Message: "edit: variable '%s' not found"},
+	{Code: 29, Message: "%s: %w"},
+	{Code: 30, Message: "undefined word: %s"},
+	// 31 is reserved, it wrapped the errors of a word before the call chain
+	{Code: 32, Message: "variable '%s' contains non-string elements in block"},
+	// 33 is reserved, it wrapped the errors of a variable before the call chain
+	{Code: 34, Message: "unrecognized token: %s"},
+	{Code: 35, Message: "unmatched ')'"},
+	{Code: 36, Message: "unmatched quote"},
+	{Code: 37, Message: "unmatched '('"},
+	{Code: 38, Message: "expected '{' to start block"},
+	{Code: 39, Message: "unmatched '{'"},
+	{Code: 40, Message: "failed to get home directory: %w"},
+	{Code: 41, Message: "failed to create .rpn directory: %w"},
+	{Code: 42, Message: "failed to marshal interpreter state: %w"},
+	{Code: 43, Message: "failed to write state to file %s: %w"},
+	{Code: 44, Message: "failed to read state from file %s: %w"},
+	{Code: 45, Message: "failed to unmarshal interpreter state: %w"},
+	{Code: 46, Message: "failed to read RPN file %s: %w"},
+	{Code: 47, Message: "failed to open file %s for export: %w"},
+	{Code: 48, Message: "failed to read RPN directory %s: %w"},
+	{Code: 49, Message: "while: condition must evaluate to a boolean or number, got %s"},
+	{Code: 50, Message: "'%s' is low level defined into the core"},
+	{Code: 51, Message: "execution interrupted by user"},
+	{Code: 52, Message: "factorial: expected a non-negative integer, got %v"},
+	{Code: 53, Message: "editfile: missing filename"},
+	{Code: 54, Message: "editfile: file not found: %s"},
+	{Code: 55, Message: "variable names cannot contain spaces: '%s'"},
+	{Code: 56, Message: "cannot define local variable '%s' in global scope"},
+	{Code: 57, Message: "semicolon out of context"},
+	{Code: 58, Message: "invalid character input: %s"},
+	{Code: 59, Message: "string bounds out of range"},
+	{Code: 60, Message: "%s: not available without an interactive front-end"},
+	{Code: 61, Message: "prompt: no more input"},
+	{Code: 62, Message: "opcode name '%s' conflicts with an existing command, word or variable"},
+	{Code: 63, Message: "invalid opcode definition: '%s'"},
+	{Code: 64, Message: "%s: not inside %d nested loops"},
+	{Code: 65, Message: "leave: unknown loop counter '%s', expected i, j or k"},
+	{Code: 66, Message: "for: step cannot be zero"},
+	{Code: 67, Message: "throw: error code must be a positive integer, got %v"},
+	{Code: 68, Message: "internal variable %s can only be set to a non-negative number"},
+	{Code: 69, Message: "%s: nothing to %s"},
+	{Code: 70, Message: "execution timed out after %v seconds"},
+	{Code: 71, Message: "stack overflow: more than %d items"},
+	{Code: 72, Message: "step budget exceeded: more than %d steps"},
+	{Code: 73, Message: "recursion too deep: more than %d nested calls"},
+	{Code: 74, Message: "internal error: %s"},
+	{Code: 75, Message: "unmatched '}'"},
+	{Code: 76, Message: "%s: not allowed in sandbox mode"},
+	{Code: 77, Message: "invalid file name '%s': absolute paths and '..' are not allowed"},
+	{Code: 78, Message: "sandbox mode cannot be turned off"},
+	{Code: 79, Message: "%s: integer result too large"},
+	{Code: 80, Message: "->frac: cannot convert %v to a fraction"},
+	{Code: 81, Message: "->dec: cannot convert %v to a decimal"},
+	{Code: 82, Message: "internal variable %s can only be set to one of: %s"},
+	{Code: 83, Message: "type error: expected a real number, got %s"},
+	{Code: 84, Message: "%s: type error: expected an integer, got %s"},
+	{Code: 85, Message: "%s: requires a word size, set _word_size"},
+	{Code: 86, Message: "']' without '['"},
+	{Code: 87, Message: "type error: expected a list, got %s"},
+	{Code: 88, Message: "%s: index %s out of range"},
+	{Code: 89, Message: "sort: cannot compare %s and %s"},
+	{Code: 90, Message: "reduce: empty list"},
+	{Code: 91, Message: "type error: expected a map, got %s"},
+	{Code: 92, Message: "get: undefined key '%s'"},
+	{Code: 93, Message: "'>>' without '<<'"},
+	{Code: 94, Message: "'>>': missing the value of key '%s'"},
+	{Code: 95, Message: "%s: type error: expected a list or a map, got %s"},
+	{Code: 96, Message: "%s: dimension mismatch, %s and %s"},
+	{Code: 97, Message: "%s: singular matrix"},
+	{Code: 98, Message: "invalid matrix: %s"},
+	{Code: 99, Message: "type error: expected a matrix, got %s"},
+	{Code: 100, Message: "%s: expected a vector, got a %s matrix"},
+	{Code: 101, Message: "%s: expected a square matrix, got a %s matrix"},
+	{Code: 102, Message: "%s: invalid count %s"},
+	{Code: 103, Message: "internal variable %s can only be set to an integer from 0 to %d"},
+}
+
+// newError creates a new error with a code and formatted message.
+func (i *Interpreter) newError(code int, args ...interface{}) error {
+	i.variables["_error"] = true
+	i.variables["_last_error"] = newInt(code)
+	for _, e := range errorDefs {
+		if e.Code == code {
+			err := fmt.Errorf(e.Message, args...)
+			return &PolishError{Code: code, Message: err.Error(), Err: errors.Unwrap(err)}
+		}
+	}
+	return &PolishError{Code: code, Message: "unknown error code"}
+}
+
+// userError creates the error raised by 'throw', with a code and message chosen by the script.
+func (i *Interpreter) userError(code int, message string) error {
+	i.variables["_error"] = true
+	i.variables["_last_error"] = newInt(code)
+	return &PolishError{Code: code, Message: message}
+}
+
+// atToken records the token whose execution failed and its position, errors not
+// raised by the interpreter (from a registered opcode for instance) being
+// converted to error 29.
+func (i *Interpreter) atToken(err error, token *string) error {
+	if isControl(err) {
+		return err
+	}
+	var perr *PolishError
+	if !errors.As(err, &perr) {
+		perr = i.newError(29, *token, err).(*PolishError)
+	}
+	if perr.Token == "" {
+		perr.Token = *token
+		perr.Pos = i.position(token)
+	}
+	return perr
+}
+
+// inFrame adds a word or a variable, called by the given token, to the call chain
+// of an error, letting the control flow signals ('exit', 'leave'...) go through.
+func (i *Interpreter) inFrame(err error, kind, name string, call *string) error {
+	if isControl(err) {
+		return err
+	}
+	var perr *PolishError
+	if !errors.As(err, &perr) {
+		perr = i.newError(29, name, err).(*PolishError)
+	}
+	perr.Chain = append(perr.Chain, Frame{Kind: kind, Name: name, Pos: i.position(call)})
+	return perr
+}
@@ -0,0 +1,118 @@
+package rpn
+
+import (
+	"errors"
+	"math"
+)
+
+// protect executes a block and returns the error it raised, if it can be caught.
+// Control flow signals (break, continue, leave, exit) are never caught, and the
+// interruption by the user (error 51) or the timeout (error 70) only if
+// _catch_interrupt is set.
+func (i *Interpreter) protect(block []string) (caught *PolishError, err error) {
+	err = i.execute(block)
+	if err == nil || isControl(err) {
+		return nil, err
+	}
+	if !errors.As(err, &caught) {
+		// Errors raised outside of the interpreter have no code
+		caught = &PolishError{Message: err.Error(), Err: err}
+	}
+	if (caught.Code == 51 || caught.Code == 70) && !i.Flag("_catch_interrupt") {
+		return nil, err
+	}
+	return caught, err
+}
+
+// tryBlocks executes the body, the handler with the error code and message on the
+// stack if the body failed, and the optional cleanup block in any case.
+func (i *Interpreter) tryBlocks(body, handler, cleanup []string) error {
+	caught, err := i.protect(body)
+	if caught != nil {
+		i.push(newInt(caught.Code))
+		i.push(caught.Message)
+		err = i.execute(handler)
+	}
+	if cleanup != nil {
+		// The cleanup clears _error, which must still report an uncaught error
+		failed, lastError := i.variables["_error"], i.variables["_last_error"]
+		if cleanupErr := i.execute(cleanup); cleanupErr != nil {
+			return cleanupErr
+		}
+		if err != nil {
+			i.variables["_error"], i.variables["_last_error"] = failed, lastError
+		}
+	}
+	return err
+}
+
+// registerExceptionOpcodes registers the words handling errors.
+func (i *Interpreter) registerExceptionOpcodes() {
+	// { body } { handler } try
+	i.opcodes["try"] = func(i *Interpreter) error {
+		handler, err := i.popBlock()
+		if err != nil {
+			return err
+		}
+		body, err := i.popBlock()
+		if err != nil {
+			return err
+		}
+		return i.tryBlocks(body, handler, nil)
+	}
+
+	// { body } { handler } { cleanup } finally
+	i.opcodes["finally"] = func(i *Interpreter) error {
+		cleanup, err := i.popBlock()
+		if err != nil {
+			return err
+		}
+		handler, err := i.popBlock()
+		if err != nil {
+			return err
+		}
+		body, err := i.popBlock()
+		if err != nil {
+			return err
+		}
+		return i.tryBlocks(body, handler, cleanup)
+	}
+
+	// { body } catch, pushes 0 or the code of the error
+	i.opcodes["catch"] = func(i *Interpreter) error {
+		body, err := i.popBlock()
+		if err != nil {
+			return err
+		}
+		caught, err := i.protect(body)
+		if caught != nil {
+			i.push(newInt(caught.Code))
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		i.push(newInt(0))
+		return nil
+	}
+
+	// code message throw
+	i.opcodes["throw"] = func(i *Interpreter) error {
+		message, err := i.pop()
+		if err != nil {
+			return err
+		}
+		code, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		if code < 1 || code != math.Trunc(code) {
+			return i.newError(67, code)
+		}
+		text, ok := message.(string)
+		if !ok {
+			return i.newError(5, TypeName(message))
+		}
+		return i.userError(int(code), text)
+	}
+}
@@ -0,0 +1,1189 @@
+// Package rpn implements the Polish RPN interpreter, independently of any user interface.
+//
+// A front-end creates an Interpreter with NewInterpreter, evaluates lines of code with Eval,
+// and subscribes to the change notifications to refresh its views.
+package rpn
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+var mainWordRegex = regexp.MustCompile(`:\s+main\s+[^;]*;`) // Regex to detect ": main ... ;"
+
+// InputProvider answers the 'prompt' command.
+type InputProvider interface {
+	// Input displays the prompt message and blocks until the user enters a line.
+	Input(prompt string) (string, error)
+}
+
+// Editor implements the interactive 'editfile' and 'edit' commands.
+type Editor interface {
+	// EditFile opens the given RPN file for editing.
+	EditFile(path string) error
+	// EditText lets the user modify a line of code, typically into the input field.
+	EditText(text string) error
+}
+
+// WordsWriter can be implemented by the Output to display the list of the
+// 'words' command itself, coloring the names for instance.
+type WordsWriter interface {
+	// WriteWords writes the sorted names of the commands, words and variables.
+	WriteWords(names []string) error
+}
+
+// Event identifies a change in the interpreter state.
+type Event int
+
+const (
+	StackChanged     Event = iota // The stack has been modified
+	VariablesChanged              // Variables have been created, modified or deleted
+	WordsChanged                  // Words have been defined or deleted
+	OutputCleared                 // The 'cls' command has been executed
+)
+
+// booleanSettings lists the internal variables that the user can modify, as booleans.
+var booleanSettings = map[string]bool{
+	"_echo_mode":       true,
+	"_degree_mode":     true,
+	"_vars_value":      true,
+	"_stack_type":      true,
+	"_hidden_vars":     true,
+	"_exit_save":       true,
+	"_catch_interrupt": true,
+	"_atomic":          true,
+	"_atomic_all":      true,
+	"_sandbox":         true,
+	"_exact":           true,
+	"_decimal":         true,
+	"_complex":         true,
+	"_signed":          true,
+}
+
+// numericSettings lists the internal variables that the user can modify, as
+// non-negative numbers.
+var numericSettings = map[string]bool{
+	"_undo_depth":      true,
+	"_timeout":         true,
+	"_max_depth":       true,
+	"_max_steps":       true,
+	"_max_recursion":   true,
+	"_max_denominator": true,
+	"_precision":       true,
+	"_word_size":       true,
+}
+
+// choiceSettings lists the internal variables that the user can set to one of
+// a few strings.
+var choiceSettings = map[string][]string{
+	"_rounding": roundingModes,
+	"_base":     baseNames,
+}
+
+// Options configures a new interpreter.
+type Options struct {
+	Output  io.Writer     // Destination of '.', 'cr', 'emit'... (discarded if nil)
+	Input   InputProvider // Source of the 'prompt' command (optional)
+	Editor  Editor        // Implementation of 'editfile' and 'edit' (optional)
+	Help    string        // Text displayed by the 'help' command
+	Version float64       // Value of the read-only '_version' variable
+	Sandbox bool          // Start in sandbox mode, refusing the access to files
+}
+
+// Interpreter holds the state of our RPN calculator.
+type Interpreter struct {
+	stack       []interface{}
+	opcodes     map[string]func(*Interpreter) error
+	variables   map[string]interface{} // Global variables
+	scopeStack  []map[string]interface{}
+	words       map[string][]string
+	registered  map[string]Opcode          // Words added with Register
+	interrupted atomic.Bool                // Set by Interrupt, checked between instructions
+	started     time.Time                  // Start of the outermost evaluation, for _timeout
+	steps       int                        // Checkpoints of the outermost evaluation
+	recursion   int                        // Number of nested executions
+	limits      limits                     // Values of _max_depth, _max_steps and _max_recursion
+	loops       []*loopFrame               // Running loops, the innermost one last
+	undos       []*snapshot                // Undo history, the most recent last
+	redos       []*snapshot                // Undone snapshots, the most recent last
+	historyUsed bool                       // Set by 'undo' and 'redo', which are not recorded
+	sources     map[string]map[*string]Pos // Positions of the tokens, by source
+	oldSources  []map[*string]Pos          // Positions of earlier evaluations still defining words
+	programs    map[programKey]*program    // Compiled words and blocks
+	generation  int                        // Incremented when the words change
+	overflow    bool                       // Set when push dropped a value beyond _max_depth
+	noCompile   bool                       // Interpret all the code, to compare both engines in the tests
+
+	output    io.Writer
+	input     InputProvider
+	editor    Editor
+	help      string
+	listeners []func(Event)
+}
+
+// NewInterpreter creates a new interpreter instance with all opcodes registered.
+func NewInterpreter(opts Options) *Interpreter {
+	output := opts.Output
+	if output == nil {
+		output = io.Discard
+	}
+	interp := &Interpreter{
+		stack:      make([]interface{}, 0),
+		opcodes:    make(map[string]func(*Interpreter) error),
+		variables:  make(map[string]interface{}),
+		scopeStack: make([]map[string]interface{}, 0),
+		words:      make(map[string][]string),
+		registered: make(map[string]Opcode),
+		sources:    make(map[string]map[*string]Pos),
+		programs:   make(map[programKey]*program),
+
+		output: output,
+		input:  opts.Input,
+		editor: opts.Editor,
+		help:   opts.Help,
+	}
+	interp.scopeStack = append(interp.scopeStack, interp.variables) // Add global scope
+	interp.variables["_echo_mode"] = true
+	interp.variables["_degree_mode"] = false
+	interp.variables["_vars_value"] = true
+	interp.variables["_stack_type"] = false
+	interp.variables["_hidden_vars"] = false
+	interp.variables["_exit_save"] = false
+	interp.variables["_catch_interrupt"] = false
+	interp.variables["_atomic"] = false
+	interp.variables["_atomic_all"] = false
+	interp.variables["_sandbox"] = opts.Sandbox
+	interp.variables["_undo_depth"] = newInt(20)
+	interp.variables["_timeout"] = newInt(0)
+	interp.variables["_max_depth"] = newInt(100000)
+	interp.variables["_max_steps"] = newInt(0)
+	interp.variables["_max_recursion"] = newInt(10000)
+	interp.variables["_exact"] = false
+	interp.variables["_max_denominator"] = newInt(1000000)
+	interp.variables["_decimal"] = false
+	interp.variables["_complex"] = false
+	interp.variables["_precision"] = newInt(defaultPrecision)
+	interp.variables["_rounding"] = "half-even"
+	interp.variables["_word_size"] = newInt(0)
+	interp.variables["_signed"] = true
+	interp.variables["_base"] = "dec"
+	interp.variables["_last_error"] = newInt(0)
+	interp.variables["_error"] = false
+	interp.variables["_last_x"] = nil // Initialize _last_x
+
+	// Add _version to internal variables
+	interp.variables["_version"] = opts.Version
+
+	interp.readLimits()
+	interp.registerOpcodes()
+	interp.guardPrivilegedWords()
+	return interp
+}
+
+// Subscribe registers a function called each time the interpreter state changes.
+// The function is called from the goroutine running Eval.
+func (i *Interpreter) Subscribe(fn func(Event)) {
+	i.listeners = append(i.listeners, fn)
+}
+
+// notify informs the subscribers of a change.
+func (i *Interpreter) notify(e Event) {
+	for _, fn := range i.listeners {
+		fn(e)
+	}
+}
+
+// Interrupt requests the running execution to stop with error 51. It can be
+// called from any goroutine, and returns false if an interruption is already pending.
+func (i *Interpreter) Interrupt() bool {
+	return i.interrupted.CompareAndSwap(false, true)
+}
+
+// Push adds a value to the stack.
+func (i *Interpreter) Push(v interface{}) {
+	i.push(v)
+}
+
+// Pop removes and returns the value on top of the stack.
+func (i *Interpreter) Pop() (interface{}, error) {
+	return i.pop()
+}
+
+// Stack returns a copy of the stack, the top of the stack being the last element.
+func (i *Interpreter) Stack() []interface{} {
+	return append([]interface{}(nil), i.stack...)
+}
+
+// Variable returns the value of a global variable.
+func (i *Interpreter) Variable(name string) (interface{}, bool) {
+	val, ok := i.variables[name]
+	return val, ok
+}
+
+// Flag returns the value of a boolean variable, false if it is not defined or not a boolean.
+func (i *Interpreter) Flag(name string) bool {
+	val, ok := i.variables[name].(bool)
+	return ok && val
+}
+
+// Variables returns a copy of the global variables.
+func (i *Interpreter) Variables() map[string]interface{} {
+	variables := make(map[string]interface{}, len(i.variables))
+	for k, v := range i.variables {
+		variables[k] = v
+	}
+	return variables
+}
+
+// Word returns the definition of a user-defined word.
+func (i *Interpreter) Word(name string) ([]string, bool) {
+	def, ok := i.words[name]
+	return def, ok
+}
+
+// Words returns a copy of the user-defined words.
+func (i *Interpreter) Words() map[string][]string {
+	words := make(map[string][]string, len(i.words))
+	for k, v := range i.words {
+		words[k] = v
+	}
+	return words
+}
+
+// Execute runs a code block, as the 'execute' of a block variable does.
+func (i *Interpreter) Execute(block []string) error {
+	return i.execute(block)
+}
+
+// AsBlock converts a value to a code block. Blocks restored from a state file are
+// []interface{}, and strings like "{ ... }" are tokenized.
+func (i *Interpreter) AsBlock(val interface{}) ([]string, bool) {
+	switch v := val.(type) {
+	case []string:
+		return v, true
+	case []interface{}:
+		block := make([]string, len(v))
+		for k, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			block[k] = s
+		}
+		return block, true
+	case string:
+		if strings.HasPrefix(v, "{") && strings.HasSuffix(v, "}") {
+			tokens, err := i.tokenize(strings.TrimSpace(v[1 : len(v)-1]))
+			if err == nil {
+				return tokens, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// push adds a value to the stack.
+func (i *Interpreter) push(v interface{}) {
+	if i.limits.depth > 0 && len(i.stack) >= i.limits.depth {
+		// The instruction pushing it stops with error 71, see checkDepth
+		i.overflow = true
+		return
+	}
+	i.stack = append(i.stack, v)
+}
+
+// pop removes and returns a value from the stack.
+func (i *Interpreter) pop() (interface{}, error) {
+	if len(i.stack) == 0 {
+		return 0, i.newError(1)
+	}
+	val := i.stack[len(i.stack)-1]
+	i.stack = i.stack[:len(i.stack)-1]
+	i.variables["_last_x"] = val // Store the popped value in _last_x
+	return val, nil
+}
+
+// popFloat pops a real number or a bool, converted to a float64.
+func (i *Interpreter) popFloat() (float64, error) {
+	val, err := i.pop()
+	if err != nil {
+		return 0, err
+	}
+	f, ok := toFloat(val)
+	if _, isComplex := val.(complex128); isComplex {
+		return 0, i.newError(83, TypeName(val))
+	} else if !ok {
+		return 0, i.newError(3, TypeName(val))
+	}
+	return f, nil
+}
+
+// popBool pops a value and asserts it's a bool.
+func (i *Interpreter) popBool() (bool, error) {
+	val, err := i.pop()
+	if err != nil {
+		return false, err
+	}
+	b, ok := val.(bool)
+	if !ok {
+		// Allow numbers to be converted to bool
+		if isNumber(val) {
+			return !isZero(val), nil
+		}
+		return false, i.newError(4, TypeName(val))
+	}
+	return b, nil
+}
+
+// popString pops a value and asserts it's a string.
+func (i *Interpreter) popString() (string, error) {
+	val, err := i.pop()
+	if err != nil {
+		return "", err
+	}
+	s, ok := val.(string)
+	if !ok {
+		return "", i.newError(5, TypeName(val))
+	}
+	return s, nil
+}
+
+// popBlock pops a value and asserts it's a code block ([]string).
+func (i *Interpreter) popBlock() ([]string, error) {
+	val, err := i.pop()
+	if err != nil {
+		return nil, err
+	}
+	block, ok := val.([]string)
+	if !ok {
+		return nil, i.newError(6, TypeName(val))
+	}
+	return block, nil
+}
+
+// compareStringSlices compares two string slices for equality.
+func compareStringSlices(s1, s2 []string) bool {
+	if len(s1) != len(s2) {
+		return false
+	}
+	for i := range s1 {
+		if s1[i] != s2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// execute runs a sequence of tokens, compiled if possible.
+func (i *Interpreter) execute(tokens []string) error {
+	defer i.unnest()
+	if err := i.nest(); err != nil {
+		return err
+	}
+	if !i.noCompile {
+		if prog := i.compiled(tokens); prog != nil {
+			return i.run(tokens, prog)
+		}
+	}
+	return i.interpret(tokens)
+}
+
+// interpret runs a sequence of tokens one by one, for the code which cannot be
+// compiled (definitions, parsing words...).
+func (i *Interpreter) interpret(tokens []string) (err error) {
+	i.variables["_error"] = false
+	commentLevel := 0
+	j := 0
+	// Errors raised while executing a token are located at this token
+	defer func() {
+		if err != nil && j < len(tokens) {
+			err = i.atToken(err, &tokens[j])
+		}
+	}()
+	for ; j < len(tokens); j++ {
+		// Check for interruption
+		if err := i.checkpoint(); err != nil {
+			return err
+		}
+
+		token := tokens[j]
+
+		if commentLevel > 0 {
+			if token == "(" {
+				commentLevel++
+			} else if token == ")" {
+				commentLevel--
+			}
+			continue
+		}
+
+		if token == "(" {
+			commentLevel++
+			continue
+		}
+
+		// Prioritize quoted strings as literals
+		if len(token) > 1 && token[0] == '"' && token[len(token)-1] == '"' {
+			i.push(token[1 : len(token)-1]) // Push the unquoted string
+			if err := i.checkDepth(); err != nil {
+				return err
+			}
+			continue // Move to next token
+		}
+
+		// Handle function definition
+		if token == ":" {
+			if len(tokens) < j+3 {
+				return i.newError(16)
+			}
+			wordName := tokens[j+1]
+
+			// Prevent defining words starting with "_"
+			if strings.HasPrefix(wordName, "_") {
+				return i.newError(17, wordName)
+			}
+
+			// Prevent defining words with the same name as an opcode
+			if _, exists := i.opcodes[wordName]; exists {
+				return i.newError(18, wordName)
+			}
+
+			// The definition is sliced out of the tokens to keep their positions
+			j += 2
+			begin := j
+			for ; j < len(tokens); j++ {
+				if tokens[j] == ";" {
+					break
+				}
+			}
+			var wordDef []string
+			if j > begin {
+				wordDef = tokens[begin:j:j]
+			}
+			i.words[wordName] = wordDef
+			i.wordsChanged()
+			continue
+		}
+
+		// Handle end of function definition or standalone semicolon
+		if token == ";" {
+			return i.newError(57) // Return an error for out-of-context semicolons
+		}
+
+		// Handle code blocks for control flow
+		if token == "{" {
+			block, end, err := i.parseBlock(tokens, j)
+			if err != nil {
+				return err
+			}
+			i.push(block)
+			if err := i.checkDepth(); err != nil {
+				return err
+			}
+			j = end
+			continue
+		}
+
+		// Handle delete command
+		if token == "delete" {
+			if len(tokens) < j+2 {
+				return i.newError(19)
+			}
+
+			name := tokens[j+1]
+
+			var targetType string
+			var targetName string
+
+			if strings.HasPrefix(name, "word:") {
+				targetType = "word"
+				targetName = strings.TrimPrefix(name, "word:")
+			} else if strings.HasPrefix(name, "var:") {
+				targetType = "variable"
+				targetName = strings.TrimPrefix(name, "var:")
+			} else {
+				targetType = "any"
+				targetName = name
+			}
+
+			if strings.HasPrefix(targetName, "_") {
+				return i.newError(20, targetName)
+			}
+
+			// Check if it's an internal command
+			if _, exists := i.opcodes[targetName]; exists {
+				if targetType == "any" || targetType == "word" {
+					return i.newError(50, targetName)
+				}
+			}
+
+			deleted := false
+			if targetType == "word" || targetType == "any" {
+				if _, ok := i.words[targetName]; ok {
+					delete(i.words, targetName)
+					i.wordsChanged()
+					deleted = true
+				}
+			}
+
+			if !deleted && (targetType == "variable" || targetType == "any") {
+				if _, ok := i.variables[targetName]; ok {
+					delete(i.variables, targetName)
+					i.notify(VariablesChanged)
+					deleted = true
+				}
+			}
+
+			if !deleted {
+				if targetType == "any" {
+					return i.newError(21, name)
+				}
+				return i.newError(22, targetType, targetName)
+			}
+			j++ // consume the name token
+			continue
+		}
+
+		// Handle see command
+		if token == "see" {
+			if len(tokens) < j+2 {
+				return i.newError(23)
+			}
+			name := tokens[j+1]
+
+			var targetType string
+			var targetName string
+
+			if strings.HasPrefix(name, "word:") {
+				targetType = "word"
+				targetName = strings.TrimPrefix(name, "word:")
+			} else if strings.HasPrefix(name, "var:") {
+				targetType = "variable"
+				targetName = strings.TrimPrefix(name, "var:")
+			} else {
+				targetType = "any"
+				targetName = name
+			}
+
+			// Check if it's an internal command
+			if _, exists := i.opcodes[targetName]; exists {
+				if targetType == "any" || targetType == "word" {
+					return i.newError(50, targetName)
+				}
+			}
+
+			found := false
+			if targetType == "word" || targetType == "any" {
+				if wordDef, ok := i.words[targetName]; ok {
+					fmt.Fprintln(i.output, formatWord(targetName, wordDef))
+					found = true
+				}
+			}
+
+			if !found && (targetType == "variable" || targetType == "any") {
+				if varVal, ok := i.variables[targetName]; ok {
+					var formattedValue string
+					switch v := varVal.(type) {
+					case []string:
+						formattedValue = "{ " + strings.Join(v, " ") + " }"
+					case []interface{}:
+						strSlice := make([]string, len(v))
+						for i, val := range v {
+							strSlice[i] = fmt.Sprintf("%v", val)
+						}
+						formattedValue = "{ " + strings.Join(strSlice, " ") + " }"
+					default:
+						formattedValue = i.Format(v)
+					}
+					fmt.Fprintln(i.output, formattedValue)
+					found = true
+				}
+			}
+
+			if !found {
+				if targetType == "any" {
+					return i.newError(21, name)
+				}
+				return i.newError(22, targetType, targetName)
+			}
+			j++ // consume the name token
+			continue
+		}
+
+		// Handle help command followed by a name, unless the name is given on the stack
+		if token == "help" && j+1 < len(tokens) && !i.helpOnStack() {
+			name := tokens[j+1]
+			// If the name is a quoted string, unquote it
+			if len(name) > 1 && name[0] == '"' && name[len(name)-1] == '"' {
+				name = name[1 : len(name)-1]
+			}
+			if !i.isDescribed(name) {
+				return i.newError(21, name)
+			}
+			if err := i.writeDescription(i.output, name); err != nil {
+				return err
+			}
+			j++ // consume the name token
+			continue
+		}
+
+		// Handle editfile command
+		if token == "editfile" {
+			if err := i.checkSandbox(token); err != nil {
+				return err
+			}
+			if i.editor == nil {
+				return i.newError(60, token)
+			}
+			if len(tokens) < j+2 {
+				return i.newError(53)
+			}
+			filename := tokens[j+1]
+			// If the name is a quoted string, unquote it
+			if len(filename) > 1 && filename[0] == '"' && filename[len(filename)-1] == '"' {
+				filename = filename[1 : len(filename)-1]
+			}
+			// Add .rpn extension if not present
+			if filepath.Ext(filename) == "" {
+				filename += ".rpn"
+			}
+			if err := i.checkFileName(filename); err != nil {
+				return err
+			}
+
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return i.newError(40, err)
+			}
+			rpnPath := filepath.Join(home, DataDir)
+			fullPath := filepath.Join(rpnPath, filename)
+
+			// No need to check for existence, the editor handles it
+			if err := i.editor.EditFile(fullPath); err != nil {
+				return err
+			}
+			j++        // consume the name token
+			return nil // Return to avoid further execution in the line
+		}
+
+		// Handle edit command
+		if token == "edit" {
+			if i.editor == nil {
+				return i.newError(60, token)
+			}
+			if len(tokens) < j+2 {
+				return i.newError(24)
+			}
+			name := tokens[j+1]
+			// If the name is a quoted string, unquote it
+			if len(name) > 1 && name[0] == '"' && name[len(name)-1] == '"' {
+				name = name[1 : len(name)-1]
+			}
+			var editString string
+			var targetType string
+
+			// Check if it's an internal command
+			if _, exists := i.opcodes[name]; exists {
+				return i.newError(50, name)
+			}
+
+			if strings.HasPrefix(name, "var:") {
+				name = strings.TrimPrefix(name, "var:")
+				targetType = "variable"
+			} else if strings.HasPrefix(name, "word:") {
+				name = strings.TrimPrefix(name, "word:")
+				targetType = "word"
+			} else {
+				// Default behavior: check words first, then variables
+				if _, ok := i.words[name]; ok {
+					targetType = "word"
+				} else if _, ok := i.variables[name]; ok {
+					targetType = "variable"
+				} else {
+					return i.newError(25, name)
+				}
+			}
+
+			switch targetType {
+			case "word":
+				if wordDef, ok := i.words[name]; ok {
+					editString = ": " + name + " " + strings.Join(wordDef, " ") + " ;"
+				} else {
+					return i.newError(26, name)
+				}
+			case "variable":
+				if varVal, ok := i.variables[name]; ok {
+					// ... (existing logic for formatting variable for editing)
+					if blockStr, isStringSlice := varVal.([]string); isStringSlice {
+						editString = "{ " + strings.Join(blockStr, " ") + " } \"" + name + "\" store"
+					} else if blockIface, isInterfaceSlice := varVal.([]interface{}); isInterfaceSlice {
+						convertedBlock := make([]string, len(blockIface))
+						for k, v := range blockIface {
+							if s, isString := v.(string); isString {
+								convertedBlock[k] = s
+							} else {
+								convertedBlock[k] = fmt.Sprintf("%v", v)
+							}
+						}
+						editString = "{ " + strings.Join(convertedBlock, " ") + " } \"" + name + "\" store"
+					} else {
+						return i.newError(27, name)
+					}
+				} else {
+					return i.newError(28, name)
+				}
+			}
+
+			if err := i.editor.EditText(editString); err != nil {
+				return err
+			}
+			j += 1 // Consume the name token
+			continue
+		}
+
+		// Main token processing logic
+		if op, exists := i.opcodes[token]; exists { // Check for opcodes
+			if op == nil {
+				return i.misplaced(token)
+			}
+			if err := op(i); err != nil {
+				return err
+			}
+		} else if strings.HasPrefix(token, "word:") { // Explicitly execute a word
+			wordName := strings.TrimPrefix(token, "word:")
+			if err := i.callExplicitWord(wordName, &tokens[j]); err != nil {
+				return err
+			}
+		} else if strings.HasPrefix(token, "var:") { // Explicitly execute a variable (as a code block) or push its value
+			varName := strings.TrimPrefix(token, "var:")
+			if err := i.callExplicitVariable(varName, &tokens[j]); err != nil {
+				return err
+			}
+		} else if wordDef, exists := i.words[token]; exists { // Check for user-defined words (default)
+			if err := i.callWord(token, wordDef, true, &tokens[j]); err != nil {
+				return err
+			}
+		} else if val, exists := i.variables[token]; exists { // Check for variables
+			if err := i.callVariable(token, val, true, &tokens[j]); err != nil {
+				return err
+			}
+		} else if val, ok := i.literal(token); ok { // Attempt to parse as a number or a boolean
+			i.push(val)
+		} else {
+			// If none of the above, it's an unrecognized token
+			return i.newError(34, token)
+		}
+		if err := i.checkDepth(); err != nil {
+			return err
+		}
+	}
+	if commentLevel > 0 {
+		return i.newError(37)
+	}
+	return nil
+}
+
+// misplaced returns the error for a parser token found out of its context, such
+// as a ')' or a '}' without its opening token.
+func (i *Interpreter) misplaced(token string) error {
+	switch token {
+	case ")":
+		return i.newError(35)
+	case "}":
+		return i.newError(75)
+	}
+	return i.newError(34, token)
+}
+
+// parseLiteral parses a number or a boolean. Numbers written without a decimal
+// point nor an exponent, or with a 0x, 0o or 0b prefix, are integers, numbers
+// written a/b are fractions, numbers with a 'd' suffix are decimals and (re,im)
+// are complex numbers.
+func parseLiteral(token string) (interface{}, bool) {
+	if token == "true" {
+		return true, true
+	} else if token == "false" {
+		return false, true
+	}
+	if n, ok := parseInteger(token); ok {
+		return n, true
+	}
+	if n, ok := parseRadix(token); ok {
+		return n, true
+	}
+	if r, ok := parseFraction(token); ok {
+		return r, true
+	}
+	if z, ok := parseComplex(token); ok {
+		return z, true
+	}
+	if strings.HasSuffix(token, "d") {
+		if d, ok := parseDecimal(strings.TrimSuffix(token, "d")); ok {
+			return d, true
+		}
+	}
+	num, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		return nil, false
+	}
+	return num, true
+}
+
+// literal parses a literal as parseLiteral does, the numbers with a decimal
+// point and no exponent being decimals in _decimal mode, and the integers
+// written with a 0x, 0o or 0b prefix being wrapped to the word size.
+func (i *Interpreter) literal(token string) (interface{}, bool) {
+	if d, ok := modeDecimal(token); ok && i.Flag("_decimal") {
+		return d, true
+	}
+	if n, ok := parseRadix(token); ok {
+		return i.wrap(n), true
+	}
+	return parseLiteral(token)
+}
+
+// modeDecimal parses the literals which are decimals in _decimal mode.
+func modeDecimal(token string) (*decimal, bool) {
+	if !strings.Contains(token, ".") {
+		return nil, false
+	}
+	return parseDecimal(token)
+}
+
+// callExplicitWord executes a word called with 'word:', in the current scope.
+func (i *Interpreter) callExplicitWord(name string, call *string) error {
+	wordDef, exists := i.words[name]
+	if !exists {
+		return i.newError(30, name)
+	}
+	return i.callWord(name, wordDef, false, call)
+}
+
+// callExplicitVariable executes a variable called with 'var:' as a code block in
+// the current scope, or pushes its value.
+func (i *Interpreter) callExplicitVariable(name string, call *string) error {
+	val, exists := i.variables[name]
+	if !exists {
+		return i.newError(15, name)
+	}
+	return i.callVariable(name, val, false, call)
+}
+
+// callWord executes the definition of a word, in a new scope for its local
+// variables if scoped is set. The call is the token which called the word.
+func (i *Interpreter) callWord(name string, wordDef []string, scoped bool, call *string) error {
+	if scoped {
+		i.scopeStack = append(i.scopeStack, make(map[string]interface{}))
+	}
+	err := i.execute(wordDef)
+	if scoped {
+		i.scopeStack = i.scopeStack[:len(i.scopeStack)-1]
+	}
+	if err != nil {
+		return i.inFrame(err, "word", name, call)
+	}
+	return nil
+}
+
+// callVariable executes a variable holding a code block, in a new scope if scoped
+// is set, or pushes its value. A string looking like a block ("{ ... }") is only
+// executed if scoped is set.
+func (i *Interpreter) callVariable(name string, val interface{}, scoped bool, call *string) error {
+	var block []string
+	switch v := val.(type) {
+	case []string:
+		block = v
+	case []interface{}:
+		// If it's []interface{}, try to convert it to []string
+		block = make([]string, len(v))
+		for k, elem := range v {
+			s, isString := elem.(string)
+			if !isString {
+				return i.newError(32, name)
+			}
+			block[k] = s
+		}
+	case string:
+		if !scoped || !strings.HasPrefix(v, "{") || !strings.HasSuffix(v, "}") {
+			i.push(val)
+			return nil
+		}
+		// If it's a string that looks like a block, tokenize and execute it
+		tokens, err := i.tokenize(strings.TrimSpace(v[1 : len(v)-1]))
+		if err != nil {
+			return i.inFrame(err, "variable", name, call)
+		}
+		block = tokens
+	default:
+		// Otherwise, push the variable's value onto the stack
+		i.push(val)
+		return nil
+	}
+
+	if scoped {
+		i.scopeStack = append(i.scopeStack, make(map[string]interface{}))
+	}
+	err := i.execute(block)
+	if scoped {
+		i.scopeStack = i.scopeStack[:len(i.scopeStack)-1]
+	}
+	if err != nil {
+		return i.inFrame(err, "variable", name, call)
+	}
+	return nil
+}
+
+// Eval parses and executes a line of RPN code.
+func (i *Interpreter) Eval(line string) error {
+	return i.EvalSource("<input>", line)
+}
+
+// EvalSource parses and executes RPN code read from a source, usually a file
+// name, which is given with the line and column of the tokens in error tracebacks.
+func (i *Interpreter) EvalSource(source, text string) error {
+	return i.evalSource(source, text, false)
+}
+
+// EvalScript executes the content of an RPN file, as 'import' does: if the script
+// defines a "main" word, it is executed after the evaluation of the whole content.
+// The source names the file in error tracebacks.
+func (i *Interpreter) EvalScript(source, content string) error {
+	return i.evalSource(source, content, mainWordRegex.MatchString(content))
+}
+
+// evalSource parses and executes RPN code, then the "main" word if runMain is
+// set, both within the same evaluation: the timeout, the limits and the panic
+// recovery of the outermost evaluation apply to "main" too.
+func (i *Interpreter) evalSource(source, text string, runMain bool) error {
+	// The timeout and the limits apply to the outermost evaluation, which
+	// forgets an interruption requested before it started
+	outermost := i.started.IsZero()
+	if outermost {
+		i.interrupted.Store(false)
+		i.started = time.Now()
+		i.steps = 0
+		i.overflow = false
+		i.readLimits()
+		defer func() { i.started = time.Time{} }()
+	}
+
+	tokens, positions, err := i.scan(source, text) // Use a custom tokenizer
+	if err != nil {
+		return err
+	}
+	i.locate(source, tokens, positions)
+
+	// In atomic mode, a failing evaluation leaves the state as it was
+	var saved *snapshot
+	if i.atomic() {
+		saved = i.takeSnapshot(i.Flag("_atomic_all"))
+	}
+
+	run := func() error {
+		if err := i.execute(tokens); err != nil {
+			return err
+		}
+		// Execute the "main" word if it was defined in the script
+		if mainWord, ok := i.words["main"]; ok && runMain {
+			if err := i.execute(mainWord); err != nil {
+				return i.inFrame(err, "word", "main", nil) // Error executing word 'main'
+			}
+		}
+		return nil
+	}
+	if outermost {
+		err = i.safeExecute(run)
+	} else {
+		err = run()
+	}
+	if err != nil && saved != nil && !errors.Is(err, ErrExit) {
+		i.restore(saved)
+	}
+	i.notify(StackChanged)
+	i.notify(VariablesChanged)
+	return err
+}
+
+// Suggestions returns the opcodes, words and variables completing the given input.
+func (i *Interpreter) Suggestions(input string) []string {
+	var suggestions []string
+	inputLower := strings.ToLower(input)
+
+	// Add opcodes
+	for op := range i.opcodes {
+		if strings.HasPrefix(op, inputLower) {
+			suggestions = append(suggestions, op)
+		}
+	}
+
+	// Add user-defined words
+	for word := range i.words {
+		if strings.HasPrefix(word, inputLower) {
+			suggestions = append(suggestions, word)
+		}
+	}
+
+	// Add variables
+	for variable := range i.variables {
+		if strings.HasPrefix(variable, inputLower) {
+			suggestions = append(suggestions, variable)
+		}
+	}
+
+	sort.Strings(suggestions)
+	return suggestions
+}
+
+// tokenize splits a line of code into tokens.
+func (i *Interpreter) tokenize(line string) ([]string, error) {
+	tokens, _, err := i.scan("<input>", line)
+	return tokens, err
+}
+
+// scan splits the code read from a source into tokens, and returns the position
+// of each token.
+func (i *Interpreter) scan(source, text string) ([]string, []Pos, error) {
+	var tokens []string
+	var positions []Pos
+	inString := false
+	inBlock := 0
+	current := ""
+	var start Pos                        // Position of the current token
+	here := Pos{Source: source, Line: 1} // Position of the current character
+
+	for _, r := range text {
+		here.Column++
+		if current == "" {
+			start = here
+		}
+		switch {
+		case unicode.IsSpace(r) && !inString && inBlock == 0:
+			if current != "" {
+				tokens = append(tokens, current)
+				positions = append(positions, start)
+				current = ""
+			}
+		case r == '"' && inBlock == 0:
+			current += string(r)
+			if inString {
+				tokens = append(tokens, current)
+				positions = append(positions, start)
+				current = ""
+			}
+			inString = !inString
+		case (r == '{' || r == '}' || r == '[' || r == ']') && !inString:
+			if current != "" {
+				tokens = append(tokens, current)
+				positions = append(positions, start)
+			}
+			tokens = append(tokens, string(r))
+			positions = append(positions, here)
+			current = ""
+		default:
+			current += string(r)
+		}
+		if r == '\n' {
+			here.Line++
+			here.Column = 0
+		}
+	}
+
+	if current != "" {
+		tokens = append(tokens, current)
+		positions = append(positions, start)
+	}
+
+	if inString {
+		err := i.newError(36).(*PolishError)
+		err.Token = "\""
+		err.Pos = start
+		return nil, nil, err
+	}
+
+	return tokens, positions, nil
+}
+
+func formatWord(wordName string, wordDef []string) string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf(": %s", wordName))
+
+	indentLevel := 1
+	indentUnit := "  "
+
+	// Group consecutive non-block tokens to print on the same line
+	for i := 0; i < len(wordDef); {
+		// Find the next block token '{' or '}'
+		nextBlockIndex := -1
+		for j := i; j < len(wordDef); j++ {
+			if wordDef[j] == "{" || wordDef[j] == "}" {
+				nextBlockIndex = j
+				break
+			}
+		}
+
+		// If there are non-block tokens before the next block token (or at the end)
+		if nextBlockIndex != i {
+			end := len(wordDef)
+			if nextBlockIndex != -1 {
+				end = nextBlockIndex
+			}
+
+			// Join and print the non-block tokens
+			if i < end {
+				builder.WriteString("\n" + strings.Repeat(indentUnit, indentLevel))
+				builder.WriteString(strings.Join(wordDef[i:end], " "))
+			}
+			i = end
+		}
+
+		// Handle the block token
+		if i < len(wordDef) {
+			tok := wordDef[i]
+			if tok == "{" {
+				builder.WriteString("\n" + strings.Repeat(indentUnit, indentLevel))
+				builder.WriteString("{")
+				indentLevel++
+			} else if tok == "}" {
+				indentLevel--
+				if indentLevel < 1 {
+					indentLevel = 1
+				}
+				builder.WriteString("\n" + strings.Repeat(indentUnit, indentLevel))
+				builder.WriteString("}")
+			}
+			i++
+		}
+	}
+
+	builder.WriteString("\n;")
+	return builder.String()
+}
+
+// parseBlock finds a matching '}' for a '{' and returns the inner tokens.
+func (i *Interpreter) parseBlock(tokens []string, start int) ([]string, int, error) {
+	if tokens[start] != "{" {
+		return nil, 0, i.newError(38)
+	}
+	balance := 1
+	for j := start + 1; j < len(tokens); j++ {
+		if tokens[j] == "{" {
+			balance++
+		} else if tokens[j] == "}" {
+			balance--
+			if balance == 0 {
+				return tokens[start+1 : j : j], j, nil
+			}
+		}
+	}
+	return nil, 0, i.newError(39)
+}
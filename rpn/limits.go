@@ -0,0 +1,108 @@
+package rpn
+
+import (
+	"fmt"
+	"time"
+)
+
+// limits holds the values of _max_depth, _max_steps and _max_recursion, read at
+// the start of each evaluation and when they are stored. 0 means no limit, or
+// maxRecursion for the recursion.
+type limits struct {
+	depth     int // Number of items on the stack
+	steps     int // Number of instructions and loop iterations of an evaluation
+	recursion int // Number of nested executions of words and blocks
+}
+
+// readLimits updates the limits from the internal variables.
+func (i *Interpreter) readLimits() {
+	limit := func(name string) int {
+		n, _ := toFloat(i.variables[name])
+		return int(n)
+	}
+	i.limits = limits{
+		depth:     limit("_max_depth"),
+		steps:     limit("_max_steps"),
+		recursion: limit("_max_recursion"),
+	}
+}
+
+// checkInterval is the number of checkpoints between two readings of the clock
+// for _timeout.
+const checkInterval = 1024
+
+// checkpoint is called before each instruction and each loop iteration. It
+// returns error 51 if an interruption was requested, error 70 if the execution
+// lasts longer than _timeout, and errors 71 and 72 if the stack or the number
+// of steps exceed their limit.
+func (i *Interpreter) checkpoint() error {
+	if i.interrupted.CompareAndSwap(true, false) {
+		return i.newError(51)
+	}
+	if i.limits.depth > 0 && len(i.stack) > i.limits.depth {
+		return i.newError(71, i.limits.depth)
+	}
+	if err := i.checkDepth(); err != nil {
+		return err
+	}
+	i.steps++
+	if i.limits.steps > 0 && i.steps > i.limits.steps {
+		return i.newError(72, i.limits.steps)
+	}
+	if i.steps%checkInterval != 0 || i.started.IsZero() {
+		return nil
+	}
+	timeout, _ := toFloat(i.variables["_timeout"])
+	if timeout > 0 && time.Since(i.started).Seconds() > timeout {
+		return i.newError(70, timeout)
+	}
+	return nil
+}
+
+// checkDepth returns error 71 if push dropped a value since the last check,
+// the stack being full. It is called after each instruction.
+func (i *Interpreter) checkDepth() error {
+	if !i.overflow {
+		return nil
+	}
+	i.overflow = false
+	return i.newError(71, i.limits.depth)
+}
+
+// maxRecursion is the hard limit of the nested executions, used when
+// _max_recursion is 0: deeper, the Go stack would overflow and crash the process.
+const maxRecursion = 100000
+
+// nest counts a nested execution, and returns error 73 beyond _max_recursion
+// or maxRecursion.
+// Every call must be followed by a call to unnest.
+func (i *Interpreter) nest() error {
+	i.recursion++
+	limit := i.limits.recursion
+	if limit == 0 {
+		limit = maxRecursion
+	}
+	if i.recursion > limit {
+		return i.newError(73, limit)
+	}
+	return nil
+}
+
+// unnest ends a nested execution counted by nest.
+func (i *Interpreter) unnest() {
+	i.recursion--
+}
+
+// safeExecute runs an outermost evaluation, a Go panic being reported as error
+// 74 after resetting the state of the interrupted execution (scopes, loops...).
+func (i *Interpreter) safeExecute(run func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			i.scopeStack = i.scopeStack[:1]
+			i.loops = nil
+			i.recursion = 0
+			err = i.newError(74, fmt.Sprint(r))
+		}
+	}()
+	return run()
+}
@@ -0,0 +1,25 @@
+package rpn
+
+import "testing"
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{`3 "_max_depth" store 1 2 3`, "1 2 3"},
+		{`3 "_max_depth" store 1 2 3 4`, "1 2 3 error 71"},
+		{`3 "_max_depth" store "abcd" "" split`, `"a" "b" "c" error 71`},
+		{`[ 1 2 3 4 ] 3 "_max_depth" store list->`, "1 2 3 error 71"},
+		{`3 "_max_depth" store [ 1 2 ] { dup dup } each`, "1 1 1 error 71"},
+		{`: r r ; 0 "_max_recursion" store r`, "error 73"},
+		{`100001 "_max_recursion" store`, "error 103"},
+	}
+	for _, test := range tests {
+		for _, noCompile := range []bool{false, true} {
+			if got := evalStack(test.source, noCompile); got != test.want {
+				t.Errorf("%q (noCompile %v): got %q, want %q", test.source, noCompile, got, test.want)
+			}
+		}
+	}
+}
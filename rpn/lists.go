@@ -0,0 +1,460 @@
+package rpn
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// list is a sequence of values, built with '[ ... ]' or '->list'. Like the
+// other values, a list is never modified once built: the list words return a
+// new list. The brackets build a matrix if the values are separated by '|'.
+type list []interface{}
+
+// mark is pushed by '[' or '<<', and collected with the values above it by
+// ']' or '>>'. Its value is the opening token.
+type mark string
+
+// popToMark removes the values above the innermost mark, which must have been
+// pushed by the given opening token, and returns them. The '|' separating the
+// rows of a matrix are not opening marks.
+func (i *Interpreter) popToMark(open string) ([]interface{}, bool) {
+	for k := len(i.stack) - 1; k >= 0; k-- {
+		if m, ok := i.stack[k].(mark); ok && m != "|" {
+			if string(m) != open {
+				return nil, false
+			}
+			items := slices.Clone(i.stack[k+1:])
+			i.stack = i.stack[:k]
+			return items, true
+		}
+	}
+	return nil, false
+}
+
+// formatList formats a list as it is written.
+func (i *Interpreter) formatList(l list) string {
+	var builder strings.Builder
+	builder.WriteString("[")
+	for _, item := range l {
+		builder.WriteString(" " + i.formatItem(item))
+	}
+	builder.WriteString(" ]")
+	return builder.String()
+}
+
+// formatItem formats an element of a list or a map, the strings being quoted
+// and the code blocks shown between braces.
+func (i *Interpreter) formatItem(item interface{}) string {
+	switch v := item.(type) {
+	case string:
+		return "\"" + v + "\""
+	case []string:
+		return "{ " + strings.Join(v, " ") + " }"
+	case []interface{}:
+		tokens := make([]string, len(v))
+		for k, token := range v {
+			tokens[k] = fmt.Sprint(token)
+		}
+		return "{ " + strings.Join(tokens, " ") + " }"
+	}
+	return i.Format(item)
+}
+
+// equalLists tells if two lists have equal elements.
+func equalLists(a, b list) bool {
+	return slices.EqualFunc(a, b, equalValues)
+}
+
+// popList pops a value and asserts it's a list.
+func (i *Interpreter) popList() (list, error) {
+	val, err := i.pop()
+	if err != nil {
+		return nil, err
+	}
+	l, ok := val.(list)
+	if !ok {
+		return nil, i.newError(87, TypeName(val))
+	}
+	return l, nil
+}
+
+// popIndex pops an index, and returns it if it is an integer from 0 to max.
+func (i *Interpreter) popIndex(word string, max int) (int, error) {
+	val, err := i.popReal()
+	if err != nil {
+		return 0, err
+	}
+	k, _ := toFloat(val)
+	if k != float64(int(k)) || k < 0 || int(k) > max {
+		return 0, i.newError(88, word, i.Format(val))
+	}
+	return int(k), nil
+}
+
+// apply runs a block on a value, and pops its result.
+func (i *Interpreter) apply(block []string, args ...interface{}) (interface{}, error) {
+	for _, arg := range args {
+		i.push(arg)
+	}
+	if err := i.execute(block); err != nil {
+		return nil, err
+	}
+	return i.pop()
+}
+
+// compareItems compares two elements of a list to sort, numbers with numbers
+// and strings with strings.
+func (i *Interpreter) compareItems(a, b interface{}) (int, error) {
+	if s, ok := a.(string); ok {
+		if t, ok := b.(string); ok {
+			return strings.Compare(s, t), nil
+		}
+	} else if isNumber(a) && isNumber(b) && rank(a) < rankComplex && rank(b) < rankComplex {
+		if c, ok := compareNumbers(promote(a, b)); ok {
+			return c, nil
+		}
+	}
+	return 0, i.newError(89, TypeName(a), TypeName(b))
+}
+
+// registerListOpcodes registers the words building and transforming lists.
+func (i *Interpreter) registerListOpcodes() {
+	i.opcodes["["] = func(i *Interpreter) error {
+		i.push(mark("["))
+		return nil
+	}
+	i.opcodes["]"] = func(i *Interpreter) error {
+		items, ok := i.popToMark("[")
+		if !ok {
+			return i.newError(86)
+		}
+		if slices.Contains(items, interface{}(mark("|"))) {
+			m, err := i.buildMatrix(items)
+			if err != nil {
+				return err
+			}
+			i.push(m)
+			return nil
+		}
+		i.push(list(items))
+		return nil
+	}
+
+	// x1 ... xn n ->list
+	i.opcodes["->list"] = func(i *Interpreter) error {
+		n, err := i.popIndex("->list", len(i.stack)-1)
+		if err != nil {
+			return err
+		}
+		l := list(slices.Clone(i.stack[len(i.stack)-n:]))
+		i.stack = i.stack[:len(i.stack)-n]
+		i.push(l)
+		return nil
+	}
+	// list list-> x1 ... xn n
+	i.opcodes["list->"] = func(i *Interpreter) error {
+		l, err := i.popList()
+		if err != nil {
+			return err
+		}
+		for _, item := range l {
+			i.push(item)
+		}
+		i.push(newInt(len(l)))
+		return nil
+	}
+
+	i.opcodes["length"] = func(i *Interpreter) error {
+		val, err := i.pop()
+		if err != nil {
+			return err
+		}
+		switch v := val.(type) {
+		case list:
+			i.push(newInt(len(v)))
+		case dict:
+			i.push(newInt(len(v)))
+		case string:
+			i.push(newInt(charCount(v)))
+		default:
+			return i.newError(95, "length", TypeName(val))
+		}
+		return nil
+	}
+
+	// list n nth
+	i.opcodes["nth"] = func(i *Interpreter) error {
+		val, err := i.popReal()
+		if err != nil {
+			return err
+		}
+		l, err := i.popList()
+		if err != nil {
+			return err
+		}
+		k, _ := toFloat(val)
+		if k != float64(int(k)) || k < 0 || int(k) >= len(l) {
+			return i.newError(88, "nth", i.Format(val))
+		}
+		i.push(l[int(k)])
+		return nil
+	}
+
+	// list x append
+	i.opcodes["append"] = func(i *Interpreter) error {
+		val, err := i.pop()
+		if err != nil {
+			return err
+		}
+		l, err := i.popList()
+		if err != nil {
+			return err
+		}
+		i.push(append(slices.Clip(l), val))
+		return nil
+	}
+
+	i.opcodes["concat"] = func(i *Interpreter) error {
+		b, err := i.popList()
+		if err != nil {
+			return err
+		}
+		a, err := i.popList()
+		if err != nil {
+			return err
+		}
+		i.push(list(slices.Concat(a, b)))
+		return nil
+	}
+
+	// list start end slice, end excluded
+	i.opcodes["slice"] = func(i *Interpreter) error {
+		a, b, err := i.popReals()
+		if err != nil {
+			return err
+		}
+		l, err := i.popList()
+		if err != nil {
+			return err
+		}
+		start, _ := toFloat(a)
+		end, _ := toFloat(b)
+		if start != float64(int(start)) || end != float64(int(end)) || start < 0 || start > end || int(end) > len(l) {
+			return i.newError(88, "slice", i.Format(a)+" "+i.Format(b))
+		}
+		i.push(slices.Clip(l[int(start):int(end)]))
+		return nil
+	}
+
+	// Reverses a list, or the characters of a string
+	i.opcodes["reverse"] = func(i *Interpreter) error {
+		if len(i.stack) > 0 {
+			if s, ok := i.stack[len(i.stack)-1].(string); ok {
+				i.pop()
+				chars := characters(s)
+				slices.Reverse(chars)
+				i.push(strings.Join(chars, ""))
+				return nil
+			}
+		}
+		l, err := i.popList()
+		if err != nil {
+			return err
+		}
+		r := slices.Clone(l)
+		slices.Reverse(r)
+		i.push(r)
+		return nil
+	}
+
+	i.opcodes["sort"] = func(i *Interpreter) error {
+		l, err := i.popList()
+		if err != nil {
+			return err
+		}
+		for k := 1; k < len(l); k++ {
+			if _, err := i.compareItems(l[0], l[k]); err != nil {
+				return err
+			}
+		}
+		r := slices.Clone(l)
+		slices.SortStableFunc(r, func(a, b interface{}) int {
+			c, _ := i.compareItems(a, b)
+			return c
+		})
+		i.push(r)
+		return nil
+	}
+
+	// Higher-order words, running a block on the elements of a list
+
+	// list {block} map
+	i.opcodes["map"] = func(i *Interpreter) error {
+		block, err := i.popBlock()
+		if err != nil {
+			return err
+		}
+		l, err := i.popList()
+		if err != nil {
+			return err
+		}
+		r := make(list, len(l))
+		for k, item := range l {
+			if r[k], err = i.apply(block, item); err != nil {
+				return err
+			}
+		}
+		i.push(r)
+		return nil
+	}
+
+	// list {predicate} filter
+	i.opcodes["filter"] = func(i *Interpreter) error {
+		block, err := i.popBlock()
+		if err != nil {
+			return err
+		}
+		l, err := i.popList()
+		if err != nil {
+			return err
+		}
+		r := list{}
+		for _, item := range l {
+			i.push(item)
+			if err := i.execute(block); err != nil {
+				return err
+			}
+			keep, err := i.popBool()
+			if err != nil {
+				return err
+			}
+			if keep {
+				r = append(r, item)
+			}
+		}
+		i.push(r)
+		return nil
+	}
+
+	// list {block} reduce, the first element being the initial value
+	i.opcodes["reduce"] = func(i *Interpreter) error {
+		block, err := i.popBlock()
+		if err != nil {
+			return err
+		}
+		l, err := i.popList()
+		if err != nil {
+			return err
+		}
+		if len(l) == 0 {
+			return i.newError(90)
+		}
+		acc := l[0]
+		for _, item := range l[1:] {
+			if acc, err = i.apply(block, acc, item); err != nil {
+				return err
+			}
+		}
+		i.push(acc)
+		return nil
+	}
+
+	// list initial {block} fold
+	i.opcodes["fold"] = func(i *Interpreter) error {
+		block, err := i.popBlock()
+		if err != nil {
+			return err
+		}
+		acc, err := i.pop()
+		if err != nil {
+			return err
+		}
+		l, err := i.popList()
+		if err != nil {
+			return err
+		}
+		for _, item := range l {
+			if acc, err = i.apply(block, acc, item); err != nil {
+				return err
+			}
+		}
+		i.push(acc)
+		return nil
+	}
+
+	// list {block} each, a loop whose index is the position of the element. The
+	// block gets the key and the value of each entry of a map.
+	i.opcodes["each"] = func(i *Interpreter) error {
+		block, err := i.popBlock()
+		if err != nil {
+			return err
+		}
+		val, err := i.pop()
+		if err != nil {
+			return err
+		}
+		var items [][]interface{}
+		switch v := val.(type) {
+		case list:
+			for _, item := range v {
+				items = append(items, []interface{}{item})
+			}
+		case dict:
+			for _, key := range v.keys() {
+				items = append(items, []interface{}{key, v[key]})
+			}
+		default:
+			return i.newError(95, "each", TypeName(val))
+		}
+		frame := i.pushLoop()
+		defer i.popLoop()
+		for k, item := range items {
+			if err := i.checkpoint(); err != nil {
+				return err
+			}
+			frame.index = float64(k)
+			for _, val := range item {
+				i.push(val)
+			}
+			if err := i.checkDepth(); err != nil {
+				return err
+			}
+			if err := i.execute(block); err != nil {
+				if err == ErrBreak {
+					break
+				} else if err == ErrContinue {
+					continue
+				} else if leave, ok := err.(*leaveSignal); ok && leave.frame == frame {
+					break
+				} else {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// decodeList converts the elements of a list read from a state file.
+func decodeList(items []interface{}) list {
+	l := make(list, len(items))
+	for k, item := range items {
+		l[k] = decodeItem(item)
+	}
+	return l
+}
+
+// decodeItem converts a value of the stack, a variable, or an element of a list
+// or a map read from a state file, the code blocks being read back as []string.
+func decodeItem(item interface{}) interface{} {
+	block, ok := item.([]interface{})
+	if !ok {
+		return decodeValue(item)
+	}
+	tokens := make([]string, len(block))
+	for k, token := range block {
+		tokens[k], _ = token.(string)
+	}
+	return tokens
+}
@@ -0,0 +1,130 @@
+package rpn
+
+import (
+	"math"
+	"math/big"
+)
+
+// loopFrame holds the state of a running 'loop', 'while' or 'for'.
+type loopFrame struct {
+	index   float64 // Current iteration, 0-based, or current value for 'for'
+	integer bool    // The index is pushed as an integer
+}
+
+// value returns the index of the loop, as pushed by 'index', 'i', 'j' and 'k'.
+func (f *loopFrame) value() interface{} {
+	if f.integer {
+		return big.NewInt(int64(f.index))
+	}
+	return f.index
+}
+
+// leaveSignal is returned by 'leave' to exit the loop owning the given frame,
+// and all the loops nested into it.
+type leaveSignal struct {
+	frame *loopFrame
+}
+
+func (l *leaveSignal) Error() string {
+	return "leave"
+}
+
+// isControl tells if an error is a control flow signal rather than a real error.
+func isControl(err error) bool {
+	if err == ErrBreak || err == ErrContinue || err == ErrExit {
+		return true
+	}
+	_, ok := err.(*leaveSignal)
+	return ok
+}
+
+// pushLoop starts a new loop frame, counting iterations with integers.
+func (i *Interpreter) pushLoop() *loopFrame {
+	frame := &loopFrame{integer: true}
+	i.loops = append(i.loops, frame)
+	return frame
+}
+
+// popLoop ends the innermost loop frame.
+func (i *Interpreter) popLoop() {
+	i.loops = i.loops[:len(i.loops)-1]
+}
+
+// loopFrameAt returns the frame of an enclosing loop, 0 being the innermost one.
+func (i *Interpreter) loopFrameAt(name string, level int) (*loopFrame, error) {
+	if len(i.loops) == 0 {
+		return nil, i.newError(10, name)
+	}
+	if level < 0 || level >= len(i.loops) {
+		return nil, i.newError(64, name, level+1)
+	}
+	return i.loops[len(i.loops)-1-level], nil
+}
+
+// loopLevels gives the level of the loop counters named i, j and k.
+var loopLevels = map[string]int{"i": 0, "j": 1, "k": 2}
+
+// forLoop returns the implementation of 'for' (inclusive) or 'xfor' (exclusive):
+// start end step {block} for
+func forLoop(inclusive bool) func(*Interpreter) error {
+	return func(i *Interpreter) error {
+		block, err := i.popBlock()
+		if err != nil {
+			return err
+		}
+		var bounds [3]float64 // start, end and step
+		integer := true
+		for k := len(bounds) - 1; k >= 0; k-- {
+			n, err := i.popReal()
+			if err != nil {
+				return err
+			}
+			_, isInt := n.(*big.Int)
+			integer = integer && isInt
+			bounds[k], _ = toFloat(n)
+		}
+		start, end, step := bounds[0], bounds[1], bounds[2]
+		if step == 0 {
+			return i.newError(66)
+		}
+
+		// Tolerance on the end value, so that fractional steps reach it despite rounding
+		epsilon := math.Abs(step) * 1e-9
+		inRange := func(value float64) bool {
+			if step > 0 {
+				if inclusive {
+					return value <= end+epsilon
+				}
+				return value < end-epsilon
+			}
+			if inclusive {
+				return value >= end-epsilon
+			}
+			return value > end+epsilon
+		}
+
+		frame := i.pushLoop()
+		frame.integer = integer
+		defer i.popLoop()
+		// The value is computed from the iteration count to avoid accumulating rounding errors
+		for n := 0; inRange(start + float64(n)*step); n++ {
+			// Check for interruption inside the loop
+			if err := i.checkpoint(); err != nil {
+				return err
+			}
+			frame.index = start + float64(n)*step // Set current loop value
+			if err := i.execute(block); err != nil {
+				if err == ErrBreak {
+					break
+				} else if err == ErrContinue {
+					continue
+				} else if leave, ok := err.(*leaveSignal); ok && leave.frame == frame {
+					break
+				} else {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,177 @@
+package rpn
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// dict is a map from strings to values, built with '<< key value ... >>'. Like
+// lists, a map is never modified once built: 'put' and 'remove' return a new map.
+type dict map[string]interface{}
+
+// keys returns the keys of a map in ascending order, the order in which the map
+// is displayed and iterated.
+func (d dict) keys() []string {
+	return slices.Sorted(maps.Keys(d))
+}
+
+// formatDict formats a map as it is written, its keys in ascending order.
+func (i *Interpreter) formatDict(d dict) string {
+	var builder strings.Builder
+	builder.WriteString("<<")
+	for _, key := range d.keys() {
+		builder.WriteString(" \"" + key + "\" " + i.formatItem(d[key]))
+	}
+	builder.WriteString(" >>")
+	return builder.String()
+}
+
+// equalDicts tells if two maps have the same keys and equal values.
+func equalDicts(a, b dict) bool {
+	return maps.EqualFunc(a, b, equalValues)
+}
+
+// popDict pops a value and asserts it's a map.
+func (i *Interpreter) popDict() (dict, error) {
+	val, err := i.pop()
+	if err != nil {
+		return nil, err
+	}
+	d, ok := val.(dict)
+	if !ok {
+		return nil, i.newError(91, TypeName(val))
+	}
+	return d, nil
+}
+
+// registerMapOpcodes registers the words building and reading maps.
+func (i *Interpreter) registerMapOpcodes() {
+	i.opcodes["<<"] = func(i *Interpreter) error {
+		i.push(mark("<<"))
+		return nil
+	}
+	i.opcodes[">>"] = func(i *Interpreter) error {
+		items, ok := i.popToMark("<<")
+		if !ok {
+			return i.newError(93)
+		}
+		d := make(dict, len(items)/2)
+		for k := 0; k < len(items); k += 2 {
+			key, ok := items[k].(string)
+			if !ok {
+				return i.newError(5, TypeName(items[k]))
+			}
+			if k+1 == len(items) {
+				return i.newError(94, key)
+			}
+			d[key] = items[k+1]
+		}
+		i.push(d)
+		return nil
+	}
+
+	// map key get
+	i.opcodes["get"] = func(i *Interpreter) error {
+		key, err := i.popString()
+		if err != nil {
+			return err
+		}
+		d, err := i.popDict()
+		if err != nil {
+			return err
+		}
+		val, ok := d[key]
+		if !ok {
+			return i.newError(92, key)
+		}
+		i.push(val)
+		return nil
+	}
+
+	// map key value put
+	i.opcodes["put"] = func(i *Interpreter) error {
+		val, err := i.pop()
+		if err != nil {
+			return err
+		}
+		key, err := i.popString()
+		if err != nil {
+			return err
+		}
+		d, err := i.popDict()
+		if err != nil {
+			return err
+		}
+		r := maps.Clone(d)
+		r[key] = val
+		i.push(r)
+		return nil
+	}
+
+	// map key has
+	i.opcodes["has"] = func(i *Interpreter) error {
+		key, err := i.popString()
+		if err != nil {
+			return err
+		}
+		d, err := i.popDict()
+		if err != nil {
+			return err
+		}
+		_, ok := d[key]
+		i.push(ok)
+		return nil
+	}
+
+	// map key remove
+	i.opcodes["remove"] = func(i *Interpreter) error {
+		key, err := i.popString()
+		if err != nil {
+			return err
+		}
+		d, err := i.popDict()
+		if err != nil {
+			return err
+		}
+		r := maps.Clone(d)
+		delete(r, key)
+		i.push(r)
+		return nil
+	}
+
+	i.opcodes["keys"] = func(i *Interpreter) error {
+		d, err := i.popDict()
+		if err != nil {
+			return err
+		}
+		keys := make(list, 0, len(d))
+		for _, key := range d.keys() {
+			keys = append(keys, key)
+		}
+		i.push(keys)
+		return nil
+	}
+
+	i.opcodes["values"] = func(i *Interpreter) error {
+		d, err := i.popDict()
+		if err != nil {
+			return err
+		}
+		values := make(list, 0, len(d))
+		for _, key := range d.keys() {
+			values = append(values, d[key])
+		}
+		i.push(values)
+		return nil
+	}
+}
+
+// decodeDict converts the values of a map read from a state file.
+func decodeDict(entries map[string]interface{}) dict {
+	d := make(dict, len(entries))
+	for key, val := range entries {
+		d[key] = decodeItem(val)
+	}
+	return d
+}
@@ -0,0 +1,635 @@
+package rpn
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// matrix is a matrix of floating-point numbers, written [| 1 2 | 3 4 |], the
+// rows being separated by '|'. A vector is a matrix of one row or one column.
+// Like the other values, a matrix is never modified once built.
+type matrix struct {
+	rows, cols int
+	data       []float64 // Elements, row by row
+}
+
+// newMatrix returns a matrix of zeros.
+func newMatrix(rows, cols int) *matrix {
+	return &matrix{rows: rows, cols: cols, data: make([]float64, rows*cols)}
+}
+
+// identity returns the identity matrix of size n.
+func identity(n int) *matrix {
+	m := newMatrix(n, n)
+	for k := 0; k < n; k++ {
+		m.set(k, k, 1)
+	}
+	return m
+}
+
+func (m *matrix) at(r, c int) float64 {
+	return m.data[r*m.cols+c]
+}
+
+func (m *matrix) set(r, c int, x float64) {
+	m.data[r*m.cols+c] = x
+}
+
+// dims returns the dimensions of a matrix, as shown in the errors.
+func (m *matrix) dims() string {
+	return strconv.Itoa(m.rows) + "x" + strconv.Itoa(m.cols)
+}
+
+// isVector tells if a matrix has one row or one column.
+func (m *matrix) isVector() bool {
+	return m.rows == 1 || m.cols == 1
+}
+
+// buildMatrix builds a matrix from the values collected by ']', the rows being
+// separated by '|' marks. The empty rows of '[|' and '|]' are ignored.
+func (i *Interpreter) buildMatrix(items []interface{}) (*matrix, error) {
+	var rows [][]float64
+	row := []float64{}
+	for k, item := range append(items, mark("|")) {
+		if m, ok := item.(mark); ok && m == "|" {
+			if len(row) > 0 || (k > 0 && k < len(items)) {
+				rows = append(rows, row)
+			}
+			row = []float64{}
+			continue
+		}
+		if _, ok := item.(complex128); ok {
+			return nil, i.newError(83, TypeName(item))
+		}
+		x, ok := toFloat(item)
+		if _, isBool := item.(bool); !ok || isBool {
+			return nil, i.newError(3, TypeName(item))
+		}
+		row = append(row, x)
+	}
+	m, problem := matrixOf(rows)
+	if m == nil {
+		return nil, i.newError(98, problem)
+	}
+	return m, nil
+}
+
+// matrixOf builds a matrix from its rows, which must have the same length. It
+// returns nil and the problem if they do not.
+func matrixOf(rows [][]float64) (*matrix, string) {
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return nil, "no elements"
+	}
+	m := newMatrix(len(rows), len(rows[0]))
+	for r, row := range rows {
+		if len(row) != m.cols {
+			return nil, "rows of different lengths"
+		}
+		copy(m.data[r*m.cols:], row)
+	}
+	return m, ""
+}
+
+// formatMatrix formats a matrix on one line, as it is written.
+func (i *Interpreter) formatMatrix(m *matrix) string {
+	var builder strings.Builder
+	builder.WriteString("[|")
+	for r := 0; r < m.rows; r++ {
+		if r > 0 {
+			builder.WriteString(" |")
+		}
+		for c := 0; c < m.cols; c++ {
+			builder.WriteString(" " + i.Format(m.at(r, c)))
+		}
+	}
+	builder.WriteString(" |]")
+	return builder.String()
+}
+
+// formatMatrixLines formats a matrix with one line by row, the columns being
+// aligned, as printed by '.'.
+func (i *Interpreter) formatMatrixLines(m *matrix) string {
+	cells := make([]string, len(m.data))
+	widths := make([]int, m.cols)
+	for k, x := range m.data {
+		cells[k] = i.Format(x)
+		widths[k%m.cols] = max(widths[k%m.cols], len(cells[k]))
+	}
+	lines := make([]string, m.rows)
+	for r := range lines {
+		var builder strings.Builder
+		builder.WriteString("[")
+		for c := 0; c < m.cols; c++ {
+			cell := cells[r*m.cols+c]
+			builder.WriteString(" " + strings.Repeat(" ", widths[c]-len(cell)) + cell)
+		}
+		builder.WriteString(" ]")
+		lines[r] = builder.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// equalMatrices tells if two matrices have the same dimensions and elements.
+func equalMatrices(a, b *matrix) bool {
+	if a.rows != b.rows || a.cols != b.cols {
+		return false
+	}
+	for k := range a.data {
+		if a.data[k] != b.data[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// popMatrix pops a value and asserts it's a matrix.
+func (i *Interpreter) popMatrix() (*matrix, error) {
+	val, err := i.pop()
+	if err != nil {
+		return nil, err
+	}
+	m, ok := val.(*matrix)
+	if !ok {
+		return nil, i.newError(99, TypeName(val))
+	}
+	return m, nil
+}
+
+// popVector pops a matrix of one row or one column.
+func (i *Interpreter) popVector(word string) (*matrix, error) {
+	v, err := i.popMatrix()
+	if err != nil {
+		return nil, err
+	}
+	if !v.isVector() {
+		return nil, i.newError(100, word, v.dims())
+	}
+	return v, nil
+}
+
+// popSize pops a number of rows or columns.
+func (i *Interpreter) popSize(word string) (int, error) {
+	val, err := i.popReal()
+	if err != nil {
+		return 0, err
+	}
+	n, _ := toFloat(val)
+	if n != math.Trunc(n) || n < 1 || n > maxMatrixSize {
+		return 0, i.newError(98, word+": size "+i.Format(val))
+	}
+	return int(n), nil
+}
+
+// maxMatrixSize is the largest number of rows or columns built by 'identity'
+// and 'zeros'.
+const maxMatrixSize = 1000
+
+// hasMatrixOperand tells if one of the n values on top of the stack is a matrix,
+// the arithmetic words then working on matrices.
+func (i *Interpreter) hasMatrixOperand(n int) bool {
+	for k := max(len(i.stack)-n, 0); k < len(i.stack); k++ {
+		if _, ok := i.stack[k].(*matrix); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matrixArith implements '+', '-', '*' and '/' when one of their operands is a
+// matrix: the sum and the difference are element-wise, '*' is the matrix
+// product, and a matrix can be combined with a real number element by element.
+func (i *Interpreter) matrixArith(op string) error {
+	b, err := i.pop()
+	if err != nil {
+		return err
+	}
+	a, err := i.pop()
+	if err != nil {
+		return err
+	}
+	ma, aIsMatrix := a.(*matrix)
+	mb, bIsMatrix := b.(*matrix)
+	if aIsMatrix && bIsMatrix {
+		var r *matrix
+		switch op {
+		case "+", "-":
+			if ma.rows != mb.rows || ma.cols != mb.cols {
+				return i.newError(96, op, ma.dims(), mb.dims())
+			}
+			r = newMatrix(ma.rows, ma.cols)
+			for k := range r.data {
+				if op == "+" {
+					r.data[k] = ma.data[k] + mb.data[k]
+				} else {
+					r.data[k] = ma.data[k] - mb.data[k]
+				}
+			}
+		case "*":
+			if ma.cols != mb.rows {
+				return i.newError(96, op, ma.dims(), mb.dims())
+			}
+			r = multiply(ma, mb)
+		default:
+			return i.newError(3, TypeName(b))
+		}
+		i.push(r)
+		return nil
+	}
+
+	// A matrix and a real number
+	m, x := ma, b
+	if bIsMatrix {
+		m, x = mb, a
+	}
+	if _, ok := x.(complex128); ok {
+		return i.newError(83, TypeName(x))
+	}
+	s, ok := toFloat(x)
+	if _, isBool := x.(bool); !ok || isBool {
+		return i.newError(3, TypeName(x))
+	}
+	if op == "/" && bIsMatrix {
+		return i.newError(3, TypeName(b))
+	}
+	if op == "/" && s == 0 {
+		return i.newError(2)
+	}
+	r := newMatrix(m.rows, m.cols)
+	for k, e := range m.data {
+		switch {
+		case op == "+":
+			r.data[k] = e + s
+		case op == "-" && aIsMatrix:
+			r.data[k] = e - s
+		case op == "-":
+			r.data[k] = s - e
+		case op == "*":
+			r.data[k] = e * s
+		default:
+			r.data[k] = e / s
+		}
+	}
+	i.push(r)
+	return nil
+}
+
+// multiply returns the matrix product of a and b, a having as many columns as
+// b has rows.
+func multiply(a, b *matrix) *matrix {
+	r := newMatrix(a.rows, b.cols)
+	for row := 0; row < a.rows; row++ {
+		for col := 0; col < b.cols; col++ {
+			var sum float64
+			for k := 0; k < a.cols; k++ {
+				sum += a.at(row, k) * b.at(k, col)
+			}
+			r.set(row, col, sum)
+		}
+	}
+	return r
+}
+
+// transpose returns the transpose of a matrix.
+func transpose(m *matrix) *matrix {
+	r := newMatrix(m.cols, m.rows)
+	for row := 0; row < m.rows; row++ {
+		for col := 0; col < m.cols; col++ {
+			r.set(col, row, m.at(row, col))
+		}
+	}
+	return r
+}
+
+// eliminate reduces the square matrix a to an upper triangular matrix by
+// Gaussian elimination with partial pivoting, applying the same operations
+// to the rows of b if it is not nil. It returns the determinant of a, 0 if a
+// is singular.
+func eliminate(a, b *matrix) float64 {
+	n := a.rows
+	det := 1.0
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a.at(row, col)) > math.Abs(a.at(pivot, col)) {
+				pivot = row
+			}
+		}
+		if a.at(pivot, col) == 0 {
+			return 0
+		}
+		if pivot != col {
+			swapRows(a, pivot, col)
+			if b != nil {
+				swapRows(b, pivot, col)
+			}
+			det = -det
+		}
+		det *= a.at(col, col)
+		for row := col + 1; row < n; row++ {
+			f := a.at(row, col) / a.at(col, col)
+			if f == 0 {
+				continue
+			}
+			for k := col; k < n; k++ {
+				a.set(row, k, a.at(row, k)-f*a.at(col, k))
+			}
+			if b != nil {
+				for k := 0; k < b.cols; k++ {
+					b.set(row, k, b.at(row, k)-f*b.at(col, k))
+				}
+			}
+		}
+	}
+	return det
+}
+
+// swapRows exchanges two rows of a matrix.
+func swapRows(m *matrix, r1, r2 int) {
+	for k := 0; k < m.cols; k++ {
+		x := m.at(r1, k)
+		m.set(r1, k, m.at(r2, k))
+		m.set(r2, k, x)
+	}
+}
+
+// clone returns a copy of a matrix, to be modified.
+func (m *matrix) clone() *matrix {
+	return &matrix{rows: m.rows, cols: m.cols, data: append([]float64(nil), m.data...)}
+}
+
+// solve returns the solution x of a x = b, a being square and b having as many
+// rows as a.
+func (i *Interpreter) solve(word string, a, b *matrix) (*matrix, error) {
+	if a.rows != a.cols {
+		return nil, i.newError(101, word, a.dims())
+	}
+	if b.rows != a.rows {
+		return nil, i.newError(96, word, a.dims(), b.dims())
+	}
+	u, x := a.clone(), b.clone()
+	if eliminate(u, x) == 0 {
+		return nil, i.newError(97, word)
+	}
+	// Back substitution
+	n := u.rows
+	for col := 0; col < x.cols; col++ {
+		for row := n - 1; row >= 0; row-- {
+			sum := x.at(row, col)
+			for k := row + 1; k < n; k++ {
+				sum -= u.at(row, k) * x.at(k, col)
+			}
+			x.set(row, col, sum/u.at(row, row))
+		}
+	}
+	return x, nil
+}
+
+// norms returns the Frobenius norm (the Euclidean norm of a vector), the
+// largest sum of the absolute values of a row, and of a column.
+func norms(m *matrix) (frobenius, rowNorm, colNorm float64) {
+	for row := 0; row < m.rows; row++ {
+		var sum float64
+		for col := 0; col < m.cols; col++ {
+			sum += math.Abs(m.at(row, col))
+			frobenius = math.Hypot(frobenius, m.at(row, col))
+		}
+		rowNorm = max(rowNorm, sum)
+	}
+	for col := 0; col < m.cols; col++ {
+		var sum float64
+		for row := 0; row < m.rows; row++ {
+			sum += math.Abs(m.at(row, col))
+		}
+		colNorm = max(colNorm, sum)
+	}
+	return
+}
+
+// registerMatrixOpcodes registers the linear algebra words. The arithmetic
+// words and 'inv' handle the matrices themselves.
+func (i *Interpreter) registerMatrixOpcodes() {
+	i.opcodes["|"] = func(i *Interpreter) error {
+		i.push(mark("|"))
+		return nil
+	}
+
+	// list ->matrix, from a list of rows or a list of numbers
+	i.opcodes["->matrix"] = func(i *Interpreter) error {
+		l, err := i.popList()
+		if err != nil {
+			return err
+		}
+		var items []interface{}
+		for k, item := range l {
+			if row, ok := item.(list); ok {
+				if k > 0 {
+					items = append(items, mark("|"))
+				}
+				items = append(items, row...)
+			} else {
+				items = append(items, item)
+			}
+		}
+		m, err := i.buildMatrix(items)
+		if err != nil {
+			return err
+		}
+		i.push(m)
+		return nil
+	}
+
+	// rows cols zeros
+	i.opcodes["zeros"] = func(i *Interpreter) error {
+		cols, err := i.popSize("zeros")
+		if err != nil {
+			return err
+		}
+		rows, err := i.popSize("zeros")
+		if err != nil {
+			return err
+		}
+		i.push(newMatrix(rows, cols))
+		return nil
+	}
+	i.opcodes["identity"] = func(i *Interpreter) error {
+		n, err := i.popSize("identity")
+		if err != nil {
+			return err
+		}
+		i.push(identity(n))
+		return nil
+	}
+
+	i.opcodes["dims"] = func(i *Interpreter) error {
+		m, err := i.popMatrix()
+		if err != nil {
+			return err
+		}
+		i.push(newInt(m.rows))
+		i.push(newInt(m.cols))
+		return nil
+	}
+
+	// matrix row col elem
+	i.opcodes["elem"] = func(i *Interpreter) error {
+		col, err := i.popReal()
+		if err != nil {
+			return err
+		}
+		row, err := i.popReal()
+		if err != nil {
+			return err
+		}
+		m, err := i.popMatrix()
+		if err != nil {
+			return err
+		}
+		r, _ := toFloat(row)
+		c, _ := toFloat(col)
+		if r != math.Trunc(r) || c != math.Trunc(c) || r < 0 || c < 0 || int(r) >= m.rows || int(c) >= m.cols {
+			return i.newError(88, "elem", i.Format(row)+" "+i.Format(col))
+		}
+		i.push(m.at(int(r), int(c)))
+		return nil
+	}
+
+	i.opcodes["transpose"] = func(i *Interpreter) error {
+		m, err := i.popMatrix()
+		if err != nil {
+			return err
+		}
+		i.push(transpose(m))
+		return nil
+	}
+
+	i.opcodes["det"] = func(i *Interpreter) error {
+		m, err := i.popMatrix()
+		if err != nil {
+			return err
+		}
+		if m.rows != m.cols {
+			return i.newError(101, "det", m.dims())
+		}
+		i.push(eliminate(m.clone(), nil))
+		return nil
+	}
+
+	// A b solve, solves the linear system A x = b
+	i.opcodes["solve"] = func(i *Interpreter) error {
+		b, err := i.popMatrix()
+		if err != nil {
+			return err
+		}
+		a, err := i.popMatrix()
+		if err != nil {
+			return err
+		}
+		x, err := i.solve("solve", a, b)
+		if err != nil {
+			return err
+		}
+		i.push(x)
+		return nil
+	}
+
+	i.opcodes["dot"] = func(i *Interpreter) error {
+		v, err := i.popVector("dot")
+		if err != nil {
+			return err
+		}
+		u, err := i.popVector("dot")
+		if err != nil {
+			return err
+		}
+		if len(u.data) != len(v.data) {
+			return i.newError(96, "dot", u.dims(), v.dims())
+		}
+		var sum float64
+		for k := range u.data {
+			sum += u.data[k] * v.data[k]
+		}
+		i.push(sum)
+		return nil
+	}
+
+	// u v cross, the product having the shape of u
+	i.opcodes["cross"] = func(i *Interpreter) error {
+		v, err := i.popVector("cross")
+		if err != nil {
+			return err
+		}
+		u, err := i.popVector("cross")
+		if err != nil {
+			return err
+		}
+		if len(u.data) != 3 || len(v.data) != 3 {
+			return i.newError(96, "cross", u.dims(), v.dims())
+		}
+		a, b := u.data, v.data
+		w := &matrix{rows: u.rows, cols: u.cols, data: []float64{
+			a[1]*b[2] - a[2]*b[1],
+			a[2]*b[0] - a[0]*b[2],
+			a[0]*b[1] - a[1]*b[0],
+		}}
+		i.push(w)
+		return nil
+	}
+
+	i.opcodes["norm"] = func(i *Interpreter) error {
+		m, err := i.popMatrix()
+		if err != nil {
+			return err
+		}
+		n, _, _ := norms(m)
+		i.push(n)
+		return nil
+	}
+	i.opcodes["rnorm"] = func(i *Interpreter) error {
+		m, err := i.popMatrix()
+		if err != nil {
+			return err
+		}
+		_, n, _ := norms(m)
+		i.push(n)
+		return nil
+	}
+	i.opcodes["cnorm"] = func(i *Interpreter) error {
+		m, err := i.popMatrix()
+		if err != nil {
+			return err
+		}
+		_, _, n := norms(m)
+		i.push(n)
+		return nil
+	}
+}
+
+// decodeMatrix converts a matrix read from a state file, as a list of rows.
+func decodeMatrix(rows []interface{}) (*matrix, bool) {
+	values := make([][]float64, len(rows))
+	for r, row := range rows {
+		items, ok := row.([]interface{})
+		if !ok {
+			return nil, false
+		}
+		for _, item := range items {
+			x, ok := item.(float64)
+			if !ok {
+				return nil, false
+			}
+			values[r] = append(values[r], x)
+		}
+	}
+	m, _ := matrixOf(values)
+	return m, m != nil
+}
+
+// encodeMatrix returns the rows of a matrix, as written to a state file.
+func encodeMatrix(m *matrix) [][]float64 {
+	rows := make([][]float64, m.rows)
+	for r := range rows {
+		rows[r] = m.data[r*m.cols : (r+1)*m.cols]
+	}
+	return rows
+}
@@ -0,0 +1,664 @@
+package rpn
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/cmplx"
+	"strconv"
+	"strings"
+)
+
+// Numbers are float64 values, exact integers (*big.Int) written without a
+// decimal point nor an exponent, decimals (*decimal) written with a 'd' suffix or
+// in _decimal mode, or exact fractions (*big.Rat) written as a/b or computed in
+// _exact mode. Integers and fractions stay exact through the arithmetic words,
+// and are promoted to float64 when mixed with floats, and to complex128 when
+// mixed with complex numbers. A fraction whose denominator is 1 is always turned
+// back into an integer. Like the other values, numbers are never modified in
+// place once on the stack.
+
+// maxIntBits limits the size of the integers computed by 'pow' and 'factorial'.
+const maxIntBits = 1 << 20
+
+// Ranks of the number types: an operation on two numbers converts the one of
+// lower rank to the type of the other.
+const (
+	rankInteger = iota
+	rankDecimal
+	rankRational
+	rankFloat
+	rankComplex
+)
+
+// parseInteger parses a decimal integer literal, with an optional sign.
+func parseInteger(token string) (*big.Int, bool) {
+	digits := token
+	if len(digits) > 0 && (digits[0] == '-' || digits[0] == '+') {
+		digits = digits[1:]
+	}
+	if len(digits) == 0 {
+		return nil, false
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return nil, false
+		}
+	}
+	return new(big.Int).SetString(token, 10)
+}
+
+// parseFraction parses a fraction literal such as 1/3 or -22/7, the
+// denominator being a positive integer.
+func parseFraction(token string) (interface{}, bool) {
+	slash := strings.IndexByte(token, '/')
+	if slash < 0 {
+		return nil, false
+	}
+	num, ok := parseInteger(token[:slash])
+	if !ok {
+		return nil, false
+	}
+	den := token[slash+1:]
+	if len(den) == 0 || den[0] == '-' || den[0] == '+' {
+		return nil, false
+	}
+	d, ok := parseInteger(den)
+	if !ok || d.Sign() == 0 {
+		return nil, false
+	}
+	return normalize(new(big.Rat).SetFrac(num, d)), true
+}
+
+// normalize returns a fraction, or an integer if its denominator is 1.
+func normalize(r *big.Rat) interface{} {
+	if r.IsInt() {
+		return new(big.Int).Set(r.Num())
+	}
+	return r
+}
+
+// newInt returns the integer value of n.
+func newInt(n int) *big.Int {
+	return big.NewInt(int64(n))
+}
+
+// isNumber tells if a value is a number. Booleans are not numbers, although the
+// words expecting a number accept them as 0 and 1.
+func isNumber(v interface{}) bool {
+	return rank(v) >= 0
+}
+
+// rank returns the rank of the type of a number, or -1 if the value is not a number.
+func rank(v interface{}) int {
+	switch v.(type) {
+	case *big.Int:
+		return rankInteger
+	case *decimal:
+		return rankDecimal
+	case *big.Rat:
+		return rankRational
+	case float64:
+		return rankFloat
+	case complex128:
+		return rankComplex
+	}
+	return -1
+}
+
+// toFloat converts a real number or a boolean to a float64.
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(n).Float64()
+		return f, true
+	case *big.Rat:
+		f, _ := n.Float64()
+		return f, true
+	case *decimal:
+		f, _ := strconv.ParseFloat(n.String(), 64)
+		return f, true
+	case bool:
+		if n {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// convert converts a number to the type of the given rank, which is not lower
+// than its own.
+func convert(v interface{}, to int) interface{} {
+	switch to {
+	case rankDecimal:
+		if n, ok := v.(*big.Int); ok {
+			return &decimal{coef: n, scale: 0}
+		}
+	case rankRational:
+		switch n := v.(type) {
+		case *big.Int:
+			return new(big.Rat).SetInt(n)
+		case *decimal:
+			return n.rat()
+		}
+	case rankFloat:
+		f, _ := toFloat(v)
+		return f
+	case rankComplex:
+		if _, ok := v.(complex128); !ok {
+			f, _ := toFloat(v)
+			return complex(f, 0)
+		}
+	}
+	return v
+}
+
+// promote converts two numbers to their common type.
+func promote(a, b interface{}) (interface{}, interface{}) {
+	to := rank(a)
+	if r := rank(b); r > to {
+		to = r
+	}
+	return convert(a, to), convert(b, to)
+}
+
+// popNumber pops a number, a boolean being converted to the integer 0 or 1.
+func (i *Interpreter) popNumber() (interface{}, error) {
+	val, err := i.pop()
+	if err != nil {
+		return nil, err
+	}
+	if b, ok := val.(bool); ok {
+		if b {
+			return newInt(1), nil
+		}
+		return newInt(0), nil
+	}
+	if !isNumber(val) {
+		return nil, i.newError(3, TypeName(val))
+	}
+	return val, nil
+}
+
+// popReal pops a number which is not complex, a boolean being converted to the
+// integer 0 or 1.
+func (i *Interpreter) popReal() (interface{}, error) {
+	val, err := i.popNumber()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := val.(complex128); ok {
+		return nil, i.newError(83, TypeName(val))
+	}
+	return val, nil
+}
+
+// popNumbers pops the operands a and b of a binary operation, b being on top of
+// the stack, and converts them to their common type.
+func (i *Interpreter) popNumbers() (interface{}, interface{}, error) {
+	b, err := i.popNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err := i.popNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	a, b = promote(a, b)
+	return a, b, nil
+}
+
+// popReals pops the operands of a binary operation as popNumbers does, which
+// must not be complex numbers.
+func (i *Interpreter) popReals() (interface{}, interface{}, error) {
+	a, b, err := i.popNumbers()
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, ok := a.(complex128); ok {
+		return nil, nil, i.newError(83, TypeName(a))
+	}
+	return a, b, nil
+}
+
+// The arithmetic functions below take two numbers of the same type, as
+// returned by promote. Decimals are rounded to the decimal context, and
+// integers wrapped to the word size.
+
+func (i *Interpreter) addNumbers(a, b interface{}) interface{} {
+	switch x := a.(type) {
+	case *big.Int:
+		return i.wrap(new(big.Int).Add(x, b.(*big.Int)))
+	case *decimal:
+		return i.addDecimals(x, b.(*decimal))
+	case *big.Rat:
+		return normalize(new(big.Rat).Add(x, b.(*big.Rat)))
+	case complex128:
+		return x + b.(complex128)
+	}
+	return a.(float64) + b.(float64)
+}
+
+func (i *Interpreter) subNumbers(a, b interface{}) interface{} {
+	switch x := a.(type) {
+	case *big.Int:
+		return i.wrap(new(big.Int).Sub(x, b.(*big.Int)))
+	case *decimal:
+		return i.subDecimals(x, b.(*decimal))
+	case *big.Rat:
+		return normalize(new(big.Rat).Sub(x, b.(*big.Rat)))
+	case complex128:
+		return x - b.(complex128)
+	}
+	return a.(float64) - b.(float64)
+}
+
+func (i *Interpreter) mulNumbers(a, b interface{}) interface{} {
+	switch x := a.(type) {
+	case *big.Int:
+		return i.wrap(new(big.Int).Mul(x, b.(*big.Int)))
+	case *decimal:
+		return i.mulDecimals(x, b.(*decimal))
+	case *big.Rat:
+		return normalize(new(big.Rat).Mul(x, b.(*big.Rat)))
+	case complex128:
+		return x * b.(complex128)
+	}
+	return a.(float64) * b.(float64)
+}
+
+// divNumbers divides two numbers. The quotient of two integers is an integer if
+// the division is exact or a word size is set, otherwise a fraction in _exact
+// mode and a float if not.
+func (i *Interpreter) divNumbers(a, b interface{}) (interface{}, error) {
+	switch x := a.(type) {
+	case *big.Int:
+		y := b.(*big.Int)
+		if y.Sign() == 0 {
+			return nil, i.newError(2)
+		}
+		q, r := new(big.Int).QuoRem(x, y, new(big.Int))
+		if r.Sign() == 0 || i.wordSize() > 0 {
+			return i.wrap(q), nil
+		}
+		if i.Flag("_exact") {
+			return new(big.Rat).SetFrac(x, y), nil
+		}
+		a, b = convert(a, rankFloat), convert(b, rankFloat)
+	case *decimal:
+		y := b.(*decimal)
+		if y.coef.Sign() == 0 {
+			return nil, i.newError(2)
+		}
+		return i.divDecimals(x, y), nil
+	case *big.Rat:
+		y := b.(*big.Rat)
+		if y.Sign() == 0 {
+			return nil, i.newError(2)
+		}
+		return normalize(new(big.Rat).Quo(x, y)), nil
+	case complex128:
+		y := b.(complex128)
+		if y == 0 {
+			return nil, i.newError(2)
+		}
+		return x / y, nil
+	}
+	if b.(float64) == 0 {
+		return nil, i.newError(2)
+	}
+	return a.(float64) / b.(float64), nil
+}
+
+// modNumbers returns the remainder of a truncated division, of the sign of a.
+func (i *Interpreter) modNumbers(a, b interface{}) (interface{}, error) {
+	switch x := a.(type) {
+	case *big.Int:
+		y := b.(*big.Int)
+		if y.Sign() == 0 {
+			return nil, i.newError(2)
+		}
+		return i.wrap(new(big.Int).Rem(x, y)), nil
+	case *decimal:
+		y := b.(*decimal)
+		if y.coef.Sign() == 0 {
+			return nil, i.newError(2)
+		}
+		return modDecimals(x, y), nil
+	case *big.Rat:
+		y := b.(*big.Rat)
+		if y.Sign() == 0 {
+			return nil, i.newError(2)
+		}
+		q := new(big.Rat).SetInt(truncRat(new(big.Rat).Quo(x, y)))
+		return normalize(q.Sub(x, q.Mul(q, y))), nil
+	case complex128:
+		return nil, i.newError(83, TypeName(x))
+	}
+	return math.Mod(a.(float64), b.(float64)), nil
+}
+
+// powNumbers raises a to the power b, exactly for an integer raised to a
+// non-negative integer, and in _exact mode for a fraction or an integer raised
+// to any integer. A decimal raised to an integer is rounded to the decimal
+// context. A negative number raised to a non-integer gives a complex number in
+// _complex mode.
+func (i *Interpreter) powNumbers(a, b interface{}) (interface{}, error) {
+	switch x := a.(type) {
+	case *big.Int:
+		y := b.(*big.Int)
+		if size := i.wordSize(); size > 0 && y.Sign() >= 0 {
+			return i.wrap(new(big.Int).Exp(x, y, new(big.Int).Lsh(big.NewInt(1), uint(size)))), nil
+		}
+		if y.Sign() >= 0 {
+			return i.expInt(x, y)
+		}
+		if i.Flag("_exact") {
+			return i.powNumbers(convert(a, rankRational), convert(b, rankRational))
+		}
+		a, b = convert(a, rankFloat), convert(b, rankFloat)
+	case *decimal:
+		if y := b.(*decimal).rat(); y.IsInt() {
+			e := new(big.Int).Abs(y.Num())
+			if !e.IsInt64() || int64(x.scale)*e.Int64() > maxIntBits {
+				return nil, i.newError(79, "pow")
+			}
+			coef, err := i.expInt(x.coef, e)
+			if err != nil {
+				return nil, err
+			}
+			p := i.roundDecimal(&decimal{coef: coef.(*big.Int), scale: x.scale * int(e.Int64())})
+			if y.Sign() >= 0 {
+				return p, nil
+			}
+			if p.coef.Sign() == 0 {
+				return nil, i.newError(2)
+			}
+			return i.divDecimals(&decimal{coef: big.NewInt(1)}, p), nil
+		}
+		a, b = convert(a, rankFloat), convert(b, rankFloat)
+	case *big.Rat:
+		y := b.(*big.Rat)
+		if y.IsInt() {
+			e := new(big.Int).Abs(y.Num())
+			num, err := i.expInt(x.Num(), e)
+			if err != nil {
+				return nil, err
+			}
+			den, err := i.expInt(x.Denom(), e)
+			if err != nil {
+				return nil, err
+			}
+			if y.Sign() < 0 {
+				if num.(*big.Int).Sign() == 0 {
+					return nil, i.newError(2)
+				}
+				num, den = den, num
+			}
+			return normalize(new(big.Rat).SetFrac(num.(*big.Int), den.(*big.Int))), nil
+		}
+		a, b = convert(a, rankFloat), convert(b, rankFloat)
+	case complex128:
+		y := b.(complex128)
+		if n := real(y); imag(y) == 0 && n == math.Trunc(n) && math.Abs(n) <= maxIntBits && x != 0 {
+			return powComplex(x, int(n)), nil
+		}
+		return cmplx.Pow(x, y), nil
+	}
+	x, y := a.(float64), b.(float64)
+	if x < 0 && y != math.Trunc(y) && i.Flag("_complex") {
+		return cmplx.Pow(complex(x, 0), complex(y, 0)), nil
+	}
+	return math.Pow(x, y), nil
+}
+
+// powComplex raises a non-zero complex number to an integer power by repeated
+// squaring, which is more accurate than cmplx.Pow.
+func powComplex(z complex128, n int) complex128 {
+	if n < 0 {
+		return 1 / powComplex(z, -n)
+	}
+	p := complex(1, 0)
+	for ; n > 0; n >>= 1 {
+		if n&1 == 1 {
+			p *= z
+		}
+		z *= z
+	}
+	return p
+}
+
+// expInt raises an integer to a non-negative integer power, refusing the
+// results larger than maxIntBits.
+func (i *Interpreter) expInt(x, y *big.Int) (interface{}, error) {
+	// The result has at least (bits of x - 1) * y bits
+	if x.BitLen() > 1 && (!y.IsInt64() || int64(x.BitLen()-1)*y.Int64() > maxIntBits) {
+		return nil, i.newError(79, "pow")
+	}
+	return new(big.Int).Exp(x, y, nil), nil
+}
+
+// truncRat returns the integer part of a fraction, rounded toward zero.
+func truncRat(r *big.Rat) *big.Int {
+	return new(big.Int).Quo(r.Num(), r.Denom())
+}
+
+// truncNumber returns the integer part of a number, rounded toward zero.
+func truncNumber(a interface{}) interface{} {
+	switch x := a.(type) {
+	case *decimal:
+		return truncDecimal(x)
+	case *big.Rat:
+		return truncRat(x)
+	case float64:
+		return math.Trunc(x)
+	}
+	return a
+}
+
+// negNumber returns the opposite of a number.
+func negNumber(a interface{}) interface{} {
+	switch x := a.(type) {
+	case *big.Int:
+		return new(big.Int).Neg(x)
+	case *decimal:
+		return &decimal{coef: new(big.Int).Neg(x.coef), scale: x.scale}
+	case *big.Rat:
+		return new(big.Rat).Neg(x)
+	case complex128:
+		return -x
+	}
+	return -a.(float64)
+}
+
+// absNumber returns the absolute value of a number, the modulus of a complex number.
+func absNumber(a interface{}) interface{} {
+	switch x := a.(type) {
+	case *big.Int:
+		return new(big.Int).Abs(x)
+	case *decimal:
+		return &decimal{coef: new(big.Int).Abs(x.coef), scale: x.scale}
+	case *big.Rat:
+		return new(big.Rat).Abs(x)
+	case complex128:
+		return cmplx.Abs(x)
+	}
+	return math.Abs(a.(float64))
+}
+
+// compareNumbers compares two real numbers of the same type, returning -1, 0
+// or 1. It returns false if one of them is NaN.
+func compareNumbers(a, b interface{}) (int, bool) {
+	switch x := a.(type) {
+	case *big.Int:
+		return x.Cmp(b.(*big.Int)), true
+	case *decimal:
+		return compareDecimals(x, b.(*decimal)), true
+	case *big.Rat:
+		return x.Cmp(b.(*big.Rat)), true
+	}
+	x, y := a.(float64), b.(float64)
+	switch {
+	case x < y:
+		return -1, true
+	case x > y:
+		return 1, true
+	case x == y:
+		return 0, true
+	}
+	return 0, false
+}
+
+// equalValues tells if two values are equal, numbers of different types being
+// compared by value.
+func equalValues(a, b interface{}) bool {
+	if isNumber(a) && isNumber(b) {
+		x, y := promote(a, b)
+		if z, ok := x.(complex128); ok {
+			return z == y.(complex128)
+		}
+		c, ok := compareNumbers(x, y)
+		return ok && c == 0
+	}
+	switch aVal := a.(type) {
+	case string:
+		bVal, ok := b.(string)
+		return ok && aVal == bVal
+	case bool:
+		bVal, ok := b.(bool)
+		return ok && aVal == bVal
+	case list:
+		bVal, ok := b.(list)
+		return ok && equalLists(aVal, bVal)
+	case dict:
+		bVal, ok := b.(dict)
+		return ok && equalDicts(aVal, bVal)
+	case *matrix:
+		bVal, ok := b.(*matrix)
+		return ok && equalMatrices(aVal, bVal)
+	}
+	return false
+}
+
+// isZero tells if a number is zero.
+func isZero(v interface{}) bool {
+	if z, ok := v.(complex128); ok {
+		return z == 0
+	}
+	f, _ := toFloat(v)
+	return f == 0
+}
+
+// TypeName returns the name of the type of a value, as shown by _stack_type.
+func TypeName(v interface{}) string {
+	switch v.(type) {
+	case *big.Int:
+		return "integer"
+	case *decimal:
+		return "decimal"
+	case *big.Rat:
+		return "rational"
+	case float64:
+		return "float64"
+	case complex128:
+		return "complex"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case []string, []interface{}:
+		return "block"
+	case list:
+		return "list"
+	case dict:
+		return "map"
+	case *matrix:
+		return "matrix"
+	case mark:
+		return "mark"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// Format returns the text of a value, as displayed in the stack view and by '.'.
+func (i *Interpreter) Format(v interface{}) string {
+	switch x := v.(type) {
+	case complex128:
+		return formatComplex(x)
+	case *big.Int:
+		return i.formatInteger(x)
+	case list:
+		return i.formatList(x)
+	case dict:
+		return i.formatDict(x)
+	case *matrix:
+		return i.formatMatrix(x)
+	case mark:
+		return string(x)
+	}
+	return fmt.Sprint(v)
+}
+
+// toFraction converts a number to an exact fraction or integer. A float is
+// approximated by the nearest fraction whose denominator does not exceed
+// _max_denominator, or converted exactly if it is 0.
+func (i *Interpreter) toFraction(v interface{}) (interface{}, error) {
+	if d, ok := v.(*decimal); ok {
+		return normalize(d.rat()), nil
+	}
+	f, ok := v.(float64)
+	if !ok {
+		return v, nil
+	}
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, i.newError(80, f)
+	}
+	exact := new(big.Rat).SetFloat64(f)
+	maxDen, _ := toFloat(i.variables["_max_denominator"])
+	if maxDen < 1 {
+		return normalize(exact), nil
+	}
+	return normalize(approximate(exact, big.NewInt(int64(maxDen)))), nil
+}
+
+// approximate returns the fraction nearest to x whose denominator does not
+// exceed maxDen, among the convergents and semiconvergents of the continued
+// fraction of x.
+func approximate(x *big.Rat, maxDen *big.Int) *big.Rat {
+	// p0/q0 and p1/q1 are the last two convergents
+	p0, q0 := big.NewInt(0), big.NewInt(1)
+	p1, q1 := big.NewInt(1), big.NewInt(0)
+	r := new(big.Rat).Set(x)
+	for {
+		a := new(big.Int).Div(r.Num(), r.Denom()) // Floor, the denominator being positive
+		q2 := new(big.Int).Add(new(big.Int).Mul(a, q1), q0)
+		if q2.Cmp(maxDen) > 0 {
+			// The best semiconvergent (p0 + t*p1) / (q0 + t*q1) within the bound
+			t := new(big.Int).Quo(new(big.Int).Sub(maxDen, q0), q1)
+			semi := new(big.Rat).SetFrac(
+				new(big.Int).Add(p0, new(big.Int).Mul(t, p1)),
+				new(big.Int).Add(q0, new(big.Int).Mul(t, q1)))
+			last := new(big.Rat).SetFrac(p1, q1)
+			if distance(x, semi).Cmp(distance(x, last)) < 0 {
+				return semi
+			}
+			return last
+		}
+		p2 := new(big.Int).Add(new(big.Int).Mul(a, p1), p0)
+		p0, q0, p1, q1 = p1, q1, p2, q2
+		r.Sub(r, new(big.Rat).SetInt(a))
+		if r.Sign() == 0 {
+			return new(big.Rat).SetFrac(p1, q1)
+		}
+		r.Inv(r)
+	}
+}
+
+// distance returns |x - y|.
+func distance(x, y *big.Rat) *big.Rat {
+	d := new(big.Rat).Sub(x, y)
+	return d.Abs(d)
+}
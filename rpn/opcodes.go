@@ -0,0 +1,1535 @@
+package rpn
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"math/cmplx"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// registerOpcodes maps string commands to their functions.
+func (i *Interpreter) registerOpcodes() {
+	// Null words treated directly into the parser
+	i.opcodes[":"] = nil
+	i.opcodes[";"] = nil
+	i.opcodes["delete"] = nil
+	i.opcodes["edit"] = nil
+	i.opcodes["editfile"] = nil
+	i.opcodes["see"] = nil
+	i.opcodes["("] = nil
+	i.opcodes[")"] = nil
+	i.opcodes["{"] = nil
+	i.opcodes["}"] = nil
+	i.opcodes["\""] = nil
+
+	// Arithmetic & String Concat
+	i.opcodes["+"] = func(i *Interpreter) error {
+		if i.hasMatrixOperand(2) {
+			return i.matrixArith("+")
+		}
+		b, err := i.pop()
+		if err != nil {
+			return err
+		}
+		a, err := i.pop()
+		if err != nil {
+			return err
+		}
+
+		switch aVal := a.(type) {
+		case string:
+			if bVal, ok := b.(string); ok {
+				i.push(aVal + bVal)
+			} else {
+				return i.newError(7, TypeName(a), TypeName(b))
+			}
+		default:
+			if !isNumber(a) {
+				return i.newError(8, TypeName(a))
+			}
+			if !isNumber(b) {
+				return i.newError(7, TypeName(a), TypeName(b))
+			}
+			i.push(i.addNumbers(promote(a, b)))
+		}
+		return nil
+	}
+
+	i.opcodes["-"] = func(i *Interpreter) error {
+		if i.hasMatrixOperand(2) {
+			return i.matrixArith("-")
+		}
+		a, b, err := i.popNumbers()
+		if err != nil {
+			return err
+		}
+		i.push(i.subNumbers(a, b))
+		return nil
+	}
+	i.opcodes["*"] = func(i *Interpreter) error {
+		if i.hasMatrixOperand(2) {
+			return i.matrixArith("*")
+		}
+		a, b, err := i.popNumbers()
+		if err != nil {
+			return err
+		}
+		i.push(i.mulNumbers(a, b))
+		return nil
+	}
+	i.opcodes["/"] = func(i *Interpreter) error {
+		if i.hasMatrixOperand(2) {
+			return i.matrixArith("/")
+		}
+		a, b, err := i.popNumbers()
+		if err != nil {
+			return err
+		}
+		q, err := i.divNumbers(a, b)
+		if err != nil {
+			return err
+		}
+		i.push(q)
+		return nil
+	}
+	i.opcodes["mod"] = func(i *Interpreter) error {
+		a, b, err := i.popNumbers()
+		if err != nil {
+			return err
+		}
+		r, err := i.modNumbers(a, b)
+		if err != nil {
+			return err
+		}
+		i.push(r)
+		return nil
+	}
+
+	// Conversions between number types, and rounding
+	i.opcodes["->frac"] = func(i *Interpreter) error {
+		a, err := i.popReal()
+		if err != nil {
+			return err
+		}
+		r, err := i.toFraction(a)
+		if err != nil {
+			return err
+		}
+		i.push(r)
+		return nil
+	}
+	i.opcodes["->dec"] = func(i *Interpreter) error {
+		a, err := i.popReal()
+		if err != nil {
+			return err
+		}
+		d, err := i.toDecimal(a)
+		if err != nil {
+			return err
+		}
+		i.push(d)
+		return nil
+	}
+	i.opcodes["->float"] = func(i *Interpreter) error {
+		a, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		i.push(a)
+		return nil
+	}
+	i.opcodes["round"] = func(i *Interpreter) error {
+		places, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		a, err := i.popReal()
+		if err != nil {
+			return err
+		}
+		r, err := i.roundNumber(a, int(places))
+		if err != nil {
+			return err
+		}
+		i.push(r)
+		return nil
+	}
+
+	i.opcodes["%"] = func(i *Interpreter) error {
+		total, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		value, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		if total == 0 {
+			return i.newError(2) // Division by zero
+		}
+		i.push((value / total) * 100)
+		return nil
+	}
+
+	// Math functions
+	i.opcodes["sqrt"] = func(i *Interpreter) error {
+		val, err := i.popNumber()
+		if err != nil {
+			return err
+		}
+		if z, ok := i.asComplex(val, isNegative); ok {
+			i.push(cmplx.Sqrt(z))
+			return nil
+		}
+		a, _ := toFloat(val)
+		i.push(math.Sqrt(a))
+		return nil
+	}
+	i.opcodes["pow"] = func(i *Interpreter) error {
+		a, b, err := i.popNumbers()
+		if err != nil {
+			return err
+		}
+		p, err := i.powNumbers(a, b)
+		if err != nil {
+			return err
+		}
+		i.push(p)
+		return nil
+	}
+	i.opcodes["nroot"] = func(i *Interpreter) error {
+		n, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		x, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		i.push(math.Pow(x, 1/n))
+		return nil
+	}
+	i.opcodes["sq"] = func(i *Interpreter) error {
+		a, err := i.popNumber()
+		if err != nil {
+			return err
+		}
+		i.push(i.mulNumbers(a, a))
+		return nil
+	}
+	i.opcodes["sin"] = func(i *Interpreter) error {
+		val, err := i.popNumber()
+		if err != nil {
+			return err
+		}
+		if z, ok := i.asComplex(val, nil); ok {
+			i.push(cmplx.Sin(z))
+			return nil
+		}
+		a, _ := toFloat(val)
+		if val, ok := i.variables["_degree_mode"].(bool); ok && val { // If in degrees mode, convert to radians
+			a = a * math.Pi / 180
+		}
+		i.push(math.Sin(a))
+		return nil
+	}
+	i.opcodes["cos"] = func(i *Interpreter) error {
+		val, err := i.popNumber()
+		if err != nil {
+			return err
+		}
+		if z, ok := i.asComplex(val, nil); ok {
+			i.push(cmplx.Cos(z))
+			return nil
+		}
+		a, _ := toFloat(val)
+		if val, ok := i.variables["_degree_mode"].(bool); ok && val { // If in degrees mode, convert to radians
+			a = a * math.Pi / 180
+		}
+		i.push(math.Cos(a))
+		return nil
+	}
+	i.opcodes["tan"] = func(i *Interpreter) error {
+		val, err := i.popNumber()
+		if err != nil {
+			return err
+		}
+		if z, ok := i.asComplex(val, nil); ok {
+			i.push(cmplx.Tan(z))
+			return nil
+		}
+		a, _ := toFloat(val)
+		if val, ok := i.variables["_degree_mode"].(bool); ok && val { // If in degrees mode, convert to radians
+			a = a * math.Pi / 180
+		}
+		i.push(math.Tan(a))
+		return nil
+	}
+	i.opcodes["log"] = func(i *Interpreter) error {
+		val, err := i.popNumber()
+		if err != nil {
+			return err
+		}
+		if z, ok := i.asComplex(val, isNegative); ok {
+			i.push(cmplx.Log10(z))
+			return nil
+		}
+		a, _ := toFloat(val)
+		i.push(math.Log10(a))
+		return nil
+	}
+	i.opcodes["pow10"] = func(i *Interpreter) error {
+		a, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		i.push(math.Pow(10, a))
+		return nil
+	}
+	i.opcodes["exp"] = func(i *Interpreter) error {
+		val, err := i.popNumber()
+		if err != nil {
+			return err
+		}
+		if z, ok := i.asComplex(val, nil); ok {
+			i.push(cmplx.Exp(z))
+			return nil
+		}
+		a, _ := toFloat(val)
+		i.push(math.Exp(a))
+		return nil
+	}
+	i.opcodes["ln"] = func(i *Interpreter) error {
+		val, err := i.popNumber()
+		if err != nil {
+			return err
+		}
+		if z, ok := i.asComplex(val, isNegative); ok {
+			i.push(cmplx.Log(z))
+			return nil
+		}
+		a, _ := toFloat(val)
+		i.push(math.Log(a))
+		return nil
+	}
+
+	i.opcodes["factorial"] = func(i *Interpreter) error {
+		n, err := i.popReal()
+		if err != nil {
+			return err
+		}
+		if d, ok := n.(*decimal); ok {
+			if r := d.rat(); r.IsInt() {
+				n = r.Num()
+			} else {
+				return i.newError(52, d)
+			}
+		}
+		if n, ok := n.(*big.Int); ok {
+			if n.Sign() < 0 {
+				return i.newError(52, n)
+			}
+			// n! has about n*log2(n) bits
+			if !n.IsInt64() || float64(n.Int64())*math.Log2(float64(n.Int64())) > maxIntBits {
+				return i.newError(79, "factorial")
+			}
+			i.push(new(big.Int).MulRange(1, n.Int64()))
+			return nil
+		}
+		if r, ok := n.(*big.Rat); ok {
+			return i.newError(52, r)
+		}
+		val := n.(float64)
+		if val < 0 || val != math.Trunc(val) {
+			return i.newError(52, val)
+		}
+		result := float64(1)
+		for k := float64(1); k <= val; k++ {
+			result *= k
+		}
+		i.push(result)
+		return nil
+	}
+	i.opcodes["int"] = func(i *Interpreter) error {
+		a, err := i.popReal()
+		if err != nil {
+			return err
+		}
+		i.push(truncNumber(a))
+		return nil
+	}
+	i.opcodes["frac"] = func(i *Interpreter) error {
+		a, err := i.popReal()
+		if err != nil {
+			return err
+		}
+		i.push(i.subNumbers(promote(a, truncNumber(a))))
+		return nil
+	}
+	i.opcodes["asin"] = func(i *Interpreter) error {
+		val, err := i.popNumber()
+		if err != nil {
+			return err
+		}
+		if z, ok := i.asComplex(val, outsideUnit); ok {
+			i.push(cmplx.Asin(z))
+			return nil
+		}
+		a, _ := toFloat(val)
+		res := math.Asin(a)
+		if val, ok := i.variables["_degree_mode"].(bool); ok && val { // If in degrees mode, convert to degrees
+			res = res * 180 / math.Pi
+		}
+		i.push(res)
+		return nil
+	}
+	i.opcodes["acos"] = func(i *Interpreter) error {
+		val, err := i.popNumber()
+		if err != nil {
+			return err
+		}
+		if z, ok := i.asComplex(val, outsideUnit); ok {
+			i.push(cmplx.Acos(z))
+			return nil
+		}
+		a, _ := toFloat(val)
+		res := math.Acos(a)
+		if val, ok := i.variables["_degree_mode"].(bool); ok && val { // If in degrees mode, convert to degrees
+			res = res * 180 / math.Pi
+		}
+		i.push(res)
+		return nil
+	}
+	i.opcodes["atan"] = func(i *Interpreter) error {
+		val, err := i.popNumber()
+		if err != nil {
+			return err
+		}
+		if z, ok := i.asComplex(val, nil); ok {
+			i.push(cmplx.Atan(z))
+			return nil
+		}
+		a, _ := toFloat(val)
+		res := math.Atan(a)
+		if val, ok := i.variables["_degree_mode"].(bool); ok && val { // If in degrees mode, convert to degrees
+			res = res * 180 / math.Pi
+		}
+		i.push(res)
+		return nil
+	}
+	i.opcodes["atan2"] = func(i *Interpreter) error {
+		y, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		x, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		res := math.Atan2(y, x)
+		if val, ok := i.variables["_degree_mode"].(bool); ok && val { // If in degrees mode, convert to degrees
+			res = res * 180 / math.Pi
+		}
+		i.push(res)
+		return nil
+	}
+
+	// Stack manipulation
+	i.opcodes["dup"] = func(i *Interpreter) error {
+		a, err := i.pop()
+		if err != nil {
+			return err
+		}
+		i.push(a)
+		i.push(a)
+		return nil
+	}
+	i.opcodes["drop"] = func(i *Interpreter) error {
+		_, err := i.pop()
+		return err
+	}
+	i.opcodes["swap"] = func(i *Interpreter) error {
+		b, err := i.pop()
+		if err != nil {
+			return err
+		}
+		a, err := i.pop()
+		if err != nil {
+			return err
+		}
+		i.push(b)
+		i.push(a)
+		return nil
+	}
+
+	i.opcodes["rot"] = func(i *Interpreter) error {
+		if len(i.stack) < 3 {
+			return i.newError(1) // Stack underflow
+		}
+		c, err := i.pop()
+		if err != nil {
+			return err
+		}
+		b, err := i.pop()
+		if err != nil {
+			return err
+		}
+		a, err := i.pop()
+		if err != nil {
+			return err
+		}
+		i.push(b)
+		i.push(c)
+		i.push(a)
+		return nil
+	}
+
+	// Comparison operators
+	i.opcodes["=="] = func(i *Interpreter) error {
+		b, err := i.pop()
+		if err != nil {
+			return err
+		}
+		a, err := i.pop()
+		if err != nil {
+			return err
+		}
+		equal := equalValues(a, b)
+		i.push(equal)
+		return nil
+	}
+	i.opcodes["!="] = func(i *Interpreter) error {
+		b, err := i.pop()
+		if err != nil {
+			return err
+		}
+		a, err := i.pop()
+		if err != nil {
+			return err
+		}
+		equal := equalValues(a, b)
+		i.push(!equal)
+		return nil
+	}
+	i.opcodes[">"] = func(i *Interpreter) error {
+		c, ok, err := i.popCompared()
+		if err != nil {
+			return err
+		}
+		i.push(ok && c > 0)
+		return nil
+	}
+	i.opcodes["<"] = func(i *Interpreter) error {
+		c, ok, err := i.popCompared()
+		if err != nil {
+			return err
+		}
+		i.push(ok && c < 0)
+		return nil
+	}
+	i.opcodes[">="] = func(i *Interpreter) error {
+		c, ok, err := i.popCompared()
+		if err != nil {
+			return err
+		}
+		i.push(ok && c >= 0)
+		return nil
+	}
+	i.opcodes["<="] = func(i *Interpreter) error {
+		c, ok, err := i.popCompared()
+		if err != nil {
+			return err
+		}
+		i.push(ok && c <= 0)
+		return nil
+	}
+
+	// Control flow
+	i.opcodes["if"] = func(i *Interpreter) error {
+		// Pop the 'then' or 'else' block first.
+		block1, err := i.popBlock()
+		if err != nil {
+			return err
+		}
+
+		// Pop the next item. It could be the 'then' block or the condition.
+		next, err := i.pop()
+		if err != nil {
+			return err
+		}
+
+		if block2, ok := next.([]string); ok {
+			// This is an if-else. Stack: condition {then} {else} if
+			// block1 is {else}, block2 is {then}
+			condition, err := i.popBool()
+			if err != nil {
+				return err
+			}
+
+			if condition {
+				err := i.execute(block2) // then block
+				if err == ErrBreak || err == ErrContinue {
+					return err // Re-propagate break/continue
+				}
+				return err
+			} else {
+				err := i.execute(block1) // else block
+				if err == ErrBreak || err == ErrContinue {
+					return err // Re-propagate break/continue
+				}
+				return err
+			}
+		} else if condition, ok := next.(bool); ok {
+			// This is a simple if. Stack: condition {then} if
+			// block1 is {then}, condition is the boolean
+			if condition {
+				err := i.execute(block1) // then block
+				if err == ErrBreak || err == ErrContinue {
+					return err // Re-propagate break/continue
+				}
+				return err
+			}
+			return nil // no else block, do nothing
+		} else if isNumber(next) {
+			// This is a simple if. Stack: condition {then} if
+			// block1 is {then}, condition is the number
+			if !isZero(next) {
+				err := i.execute(block1) // then block
+				if err == ErrBreak || err == ErrContinue {
+					return err // Re-propagate break/continue
+				}
+				return err
+			}
+			return nil // no else block, do nothing
+		} else {
+			return i.newError(9)
+		}
+	}
+	i.opcodes["loop"] = func(i *Interpreter) error {
+		block, err := i.popBlock()
+		if err != nil {
+			return err
+		}
+		count, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		frame := i.pushLoop()
+		defer i.popLoop()
+		for j := 0; j < int(count); j++ {
+			// Check for interruption inside the loop
+			if err := i.checkpoint(); err != nil {
+				return err
+			}
+			frame.index = float64(j) // Set current loop index
+			if err := i.execute(block); err != nil {
+				if err == ErrBreak {
+					break
+				} else if err == ErrContinue {
+					continue
+				} else if leave, ok := err.(*leaveSignal); ok && leave.frame == frame {
+					break
+				} else {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	i.opcodes["while"] = func(i *Interpreter) error {
+		bodyBlock, err := i.popBlock()
+		if err != nil {
+			return err
+		}
+		conditionBlock, err := i.popBlock()
+		if err != nil {
+			return err
+		}
+
+		frame := i.pushLoop()
+		defer i.popLoop()
+		for ; ; frame.index++ {
+			// Check for interruption inside the loop
+			if err := i.checkpoint(); err != nil {
+				return err
+			}
+			// Execute the condition block
+			if err := i.execute(conditionBlock); err != nil {
+				return err
+			}
+
+			// Pop the result of the condition
+			condResult, err := i.pop()
+			if err != nil {
+				return err
+			}
+
+			// Evaluate the condition, any number being true unless it is zero
+			condition, ok := condResult.(bool)
+			if !ok {
+				if !isNumber(condResult) {
+					return i.newError(49, TypeName(condResult))
+				}
+				condition = !isZero(condResult)
+			}
+
+			if !condition {
+				break // Exit loop if condition is false
+			}
+
+			// Execute the body block
+			if err := i.execute(bodyBlock); err != nil {
+				if err == ErrBreak {
+					break
+				} else if err == ErrContinue {
+					continue
+				} else if leave, ok := err.(*leaveSignal); ok && leave.frame == frame {
+					break
+				} else {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	i.opcodes["for"] = forLoop(true)
+	i.opcodes["xfor"] = forLoop(false)
+
+	i.opcodes["break"] = func(i *Interpreter) error {
+		return ErrBreak
+	}
+
+	i.opcodes["continue"] = func(i *Interpreter) error {
+		return ErrContinue
+	}
+
+	// Exit the loop given by its level (0 for the innermost) or by its counter name (i, j, k)
+	i.opcodes["leave"] = func(i *Interpreter) error {
+		val, err := i.pop()
+		if err != nil {
+			return err
+		}
+		level := 0
+		switch v := val.(type) {
+		case float64, *big.Int:
+			f, _ := toFloat(v)
+			level = int(f)
+		case string:
+			l, ok := loopLevels[v]
+			if !ok {
+				return i.newError(65, v)
+			}
+			level = l
+		default:
+			return i.newError(3, TypeName(val))
+		}
+		frame, err := i.loopFrameAt("leave", level)
+		if err != nil {
+			return err
+		}
+		return &leaveSignal{frame: frame}
+	}
+
+	i.registerExceptionOpcodes()
+	i.registerUndoOpcodes()
+	i.registerComplexOpcodes()
+	i.registerBitOpcodes()
+	i.registerListOpcodes()
+	i.registerMapOpcodes()
+	i.registerMatrixOpcodes()
+	i.registerStringOpcodes()
+
+	// Loop index
+	i.opcodes["index"] = func(i *Interpreter) error {
+		frame, err := i.loopFrameAt("index", 0)
+		if err != nil {
+			return err
+		}
+		i.push(frame.value())
+		return nil
+	}
+	for name, level := range loopLevels {
+		name, level := name, level
+		i.opcodes[name] = func(i *Interpreter) error {
+			frame, err := i.loopFrameAt(name, level)
+			if err != nil {
+				return err
+			}
+			i.push(frame.value())
+			return nil
+		}
+	}
+
+	// Storage
+	i.opcodes["store"] = func(i *Interpreter) error {
+		name, err := i.popString()
+		if err != nil {
+			return err
+		}
+		if strings.Contains(name, " ") {
+			return i.newError(55, name)
+		}
+		val, err := i.pop()
+		if err != nil {
+			return err
+		}
+
+		if strings.HasPrefix(name, "$") {
+			if len(i.scopeStack) > 1 {
+				currentScope := i.scopeStack[len(i.scopeStack)-1]
+				currentScope[name] = val
+			} else {
+				return i.newError(56, name)
+			}
+			return nil
+		}
+
+		// Prevent defining variables with the same name as an opcode
+		if _, exists := i.opcodes[name]; exists {
+			return i.newError(11, name)
+		}
+
+		// Handle internal variables (names starting with '_')
+		if strings.HasPrefix(name, "_") {
+			// Check if it's an attempt to create a *new* internal variable
+			if _, exists := i.variables[name]; !exists {
+				return i.newError(12, name)
+			}
+
+			// If it's an *existing* internal variable, apply type protection
+			switch {
+			case name == "_sandbox" && val == false:
+				return i.newError(78)
+			case booleanSettings[name]:
+				if _, ok := val.(bool); !ok {
+					return i.newError(13, name)
+				}
+			case name == "_word_size":
+				if n, _ := toFloat(val); !isNumber(val) || !slices.Contains(wordSizes, int(n)) || n != math.Trunc(n) {
+					return i.newError(82, name, "0, 8, 16, 32, 64")
+				}
+			case name == "_precision":
+				if n, _ := toFloat(val); !isNumber(val) || n < 0 || n > maxPrecision || n != math.Trunc(n) {
+					return i.newError(103, name, maxPrecision)
+				}
+			case name == "_max_recursion":
+				if n, _ := toFloat(val); !isNumber(val) || n < 0 || n > maxRecursion || n != math.Trunc(n) {
+					return i.newError(103, name, maxRecursion)
+				}
+			case numericSettings[name]:
+				if n, _ := toFloat(val); !isNumber(val) || n < 0 {
+					return i.newError(68, name)
+				}
+			case choiceSettings[name] != nil:
+				if s, ok := val.(string); !ok || !slices.Contains(choiceSettings[name], s) {
+					return i.newError(82, name, strings.Join(choiceSettings[name], ", "))
+				}
+			default:
+				return i.newError(14, name)
+			}
+		}
+
+		i.variables[name] = val
+		if numericSettings[name] {
+			i.readLimits()
+		}
+		return nil
+	}
+	i.opcodes["load"] = func(i *Interpreter) error {
+		name, err := i.popString()
+		if err != nil {
+			return err
+		}
+
+		if strings.HasPrefix(name, "$") {
+			for j := len(i.scopeStack) - 1; j >= 1; j-- {
+				if val, ok := i.scopeStack[j][name]; ok {
+					i.push(val)
+					return nil
+				}
+			}
+			return i.newError(15, name)
+		}
+
+		val, ok := i.variables[name]
+		if !ok {
+			return i.newError(15, name)
+		}
+		i.push(val)
+		return nil
+	}
+
+	// String manipulation
+	i.opcodes["len"] = func(i *Interpreter) error {
+		s, err := i.popString()
+		if err != nil {
+			return err
+		}
+		i.push(newInt(charCount(s)))
+		return nil
+	}
+	i.opcodes["bytelen"] = func(i *Interpreter) error {
+		s, err := i.popString()
+		if err != nil {
+			return err
+		}
+		i.push(newInt(len(s)))
+		return nil
+	}
+	// s start length mid, a negative start counting from the end of the string
+	i.opcodes["mid"] = func(i *Interpreter) error {
+		length, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		start, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		s, err := i.popString()
+		if err != nil {
+			return err
+		}
+		chars := characters(s)
+		if start < 0 {
+			start += float64(len(chars))
+		}
+		if int(start) >= 0 && int(start) < len(chars) && length >= 0 && int(start+length) <= len(chars) {
+			i.push(strings.Join(chars[int(start):int(start+length)], ""))
+			return nil
+		} else {
+			return i.newError(59)
+		}
+	}
+	i.opcodes["chars"] = func(i *Interpreter) error {
+		s, err := i.popString()
+		if err != nil {
+			return err
+		}
+		chars := make(list, 0, len(s))
+		for _, c := range characters(s) {
+			chars = append(chars, c)
+		}
+		i.push(chars)
+		return nil
+	}
+
+	// Output
+	i.opcodes["."] = func(i *Interpreter) error {
+		val, err := i.pop()
+		if err != nil {
+			return err
+		}
+		if m, ok := val.(*matrix); ok {
+			fmt.Fprint(i.output, i.formatMatrixLines(m))
+			return nil
+		}
+		fmt.Fprint(i.output, i.Format(val))
+		return nil
+	}
+	i.opcodes["print"] = i.opcodes["."]
+	i.opcodes["cr"] = func(i *Interpreter) error {
+		fmt.Fprintln(i.output)
+		return nil
+	}
+	i.opcodes["cls"] = func(i *Interpreter) error {
+		i.notify(OutputCleared)
+		return nil
+	}
+
+	// State management
+	i.opcodes["save"] = func(i *Interpreter) error {
+		filename, err := i.popString()
+		if err != nil {
+			return err
+		}
+		if !strings.HasSuffix(filename, ".json") {
+			filename += ".json"
+		}
+		return i.SaveState(filename)
+	}
+	i.opcodes["restore"] = func(i *Interpreter) error {
+		filename, err := i.popString()
+		if err != nil {
+			return err
+		}
+		if !strings.HasSuffix(filename, ".json") {
+			filename += ".json"
+		}
+		return i.LoadState(filename)
+	}
+
+	i.opcodes["import"] = func(i *Interpreter) error {
+		filename, err := i.popString()
+		if err != nil {
+			return err
+		}
+		if !strings.HasSuffix(filename, ".rpn") {
+			filename += ".rpn"
+		}
+		if err := i.checkFileName(filename); err != nil {
+			return err
+		}
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return i.newError(40, err)
+		}
+		rpnPath := filepath.Join(home, DataDir)
+		fullPath := filepath.Join(rpnPath, filename)
+
+		content, err := ioutil.ReadFile(fullPath)
+		if err != nil {
+			return i.newError(46, fullPath, err)
+		}
+
+		return i.EvalScript(filename, string(content)) // Execute the content of the imported file
+	}
+
+	i.opcodes["export"] = func(i *Interpreter) error {
+		filename, err := i.popString()
+		if err != nil {
+			return err
+		}
+		wordName, err := i.popString()
+		if err != nil {
+			return err
+		}
+
+		wordDef, ok := i.words[wordName]
+		if !ok {
+			return i.newError(30, wordName)
+		}
+
+		if strings.HasPrefix(wordName, "_") {
+			return i.newError(17, wordName)
+		}
+
+		if !strings.HasSuffix(filename, ".rpn") {
+			filename += ".rpn"
+		}
+		if err := i.checkFileName(filename); err != nil {
+			return err
+		}
+
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return i.newError(40, err)
+		}
+		rpnPath := filepath.Join(home, DataDir)
+		if err := os.MkdirAll(rpnPath, 0755); err != nil {
+			return i.newError(41, err)
+		}
+		fullPath := filepath.Join(rpnPath, filename)
+
+		file, err := os.OpenFile(fullPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return i.newError(47, fullPath, err)
+		}
+		defer file.Close()
+
+		timestamp := time.Now().Format("2006-01-02 15:04:05")
+		comment := fmt.Sprintf("( %s - %s )", wordName, timestamp)
+		fmt.Fprintln(file, comment)
+
+		fmt.Fprintln(file, formatWord(wordName, wordDef))
+
+		fmt.Fprintln(file, "")
+
+		return nil
+	}
+
+	i.opcodes["list"] = func(i *Interpreter) error {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return i.newError(40, err)
+		}
+		rpnPath := filepath.Join(home, DataDir)
+
+		files, err := ioutil.ReadDir(rpnPath)
+		if err != nil {
+			return i.newError(48, rpnPath, err)
+		}
+
+		fmt.Fprintln(i.output, "RPN files in ~/.polish:")
+		found := false
+		for _, file := range files {
+			if !file.IsDir() && strings.HasSuffix(file.Name(), ".rpn") {
+				fmt.Fprintln(i.output, "  -", file.Name())
+				found = true
+			}
+		}
+
+		if !found {
+			fmt.Fprintln(i.output, "  (No .rpn files found)")
+		}
+
+		return nil
+	}
+
+	// Prompt command
+	i.opcodes["prompt"] = func(i *Interpreter) error {
+		promptMsg, err := i.popString()
+		if err != nil {
+			return err
+		}
+
+		if i.input == nil {
+			return i.newError(60, "prompt")
+		}
+
+		// Block until the front-end provides the input.
+		input, err := i.input.Input(promptMsg)
+		if err == io.EOF {
+			return i.newError(61)
+		} else if err != nil {
+			return err
+		}
+
+		// Push the received input onto the stack.
+		i.push(input)
+		return nil
+	}
+
+	i.opcodes["words"] = func(i *Interpreter) error {
+		var allWords []string
+
+		// Get core commands
+		for opcode := range i.opcodes {
+			allWords = append(allWords, opcode)
+		}
+
+		// Get user-defined words
+		for word := range i.words {
+			allWords = append(allWords, word)
+		}
+
+		// Get variables
+		for variable := range i.variables {
+			allWords = append(allWords, variable)
+		}
+
+		sort.Strings(allWords)
+		if w, ok := i.output.(WordsWriter); ok {
+			return w.WriteWords(allWords)
+		}
+		fmt.Fprintln(i.output, strings.Join(allWords, " "))
+		return nil
+	}
+
+	// Time and Date
+	i.opcodes["time"] = func(i *Interpreter) error {
+		i.push(time.Now().Format("15:04:05"))
+		return nil
+	}
+	i.opcodes["date"] = func(i *Interpreter) error {
+		i.push(time.Now().Format("2006-01-02"))
+		return nil
+	}
+	i.opcodes["year"] = func(i *Interpreter) error {
+		i.push(newInt(int(time.Now().Year())))
+		return nil
+	}
+	i.opcodes["month"] = func(i *Interpreter) error {
+		i.push(newInt(int(time.Now().Month())))
+		return nil
+	}
+	i.opcodes["day"] = func(i *Interpreter) error {
+		i.push(newInt(int(time.Now().Day())))
+		return nil
+	}
+	i.opcodes["hour"] = func(i *Interpreter) error {
+		i.push(newInt(int(time.Now().Hour())))
+		return nil
+	}
+	i.opcodes["minute"] = func(i *Interpreter) error {
+		i.push(newInt(int(time.Now().Minute())))
+		return nil
+	}
+	i.opcodes["second"] = func(i *Interpreter) error {
+		i.push(newInt(int(time.Now().Second())))
+		return nil
+	}
+
+	// Stack manipulation
+	i.opcodes["clear"] = func(i *Interpreter) error {
+		i.stack = make([]interface{}, 0)
+		return nil
+	}
+
+	i.opcodes["free"] = func(i *Interpreter) error {
+		newVariables := make(map[string]interface{})
+		for name, value := range i.variables {
+			if strings.HasPrefix(name, "_") {
+				newVariables[name] = value
+			}
+		}
+		i.variables = newVariables
+		i.scopeStack[0] = i.variables
+		i.notify(VariablesChanged)
+		return nil
+	}
+
+	i.opcodes["forget"] = func(i *Interpreter) error {
+		i.words = make(map[string][]string, 0)
+		i.wordsChanged()
+		return nil
+	}
+
+	// Constants
+	i.opcodes["pi"] = func(i *Interpreter) error {
+		i.push(math.Pi)
+		return nil
+	}
+	i.opcodes["e"] = func(i *Interpreter) error {
+		i.push(math.E)
+		return nil
+	}
+	// Phi (Golden Ratio) - not directly in math package, calculate it
+	i.opcodes["phi"] = func(i *Interpreter) error {
+		i.push((1 + math.Sqrt(5)) / 2)
+		return nil
+	}
+
+	// Random number generation
+	i.opcodes["rand"] = func(i *Interpreter) error {
+		i.push(rand.Float64())
+		return nil
+	}
+
+	// Stack depth
+	i.opcodes["depth"] = func(i *Interpreter) error {
+		i.push(newInt(len(i.stack)))
+		return nil
+	}
+
+	// Boolean operations
+	i.opcodes["true"] = func(i *Interpreter) error {
+		i.push(true)
+		return nil
+	}
+	i.opcodes["false"] = func(i *Interpreter) error {
+		i.push(false)
+		return nil
+	}
+	i.opcodes["and"] = func(i *Interpreter) error {
+		b, err := i.popBool()
+		if err != nil {
+			return err
+		}
+		a, err := i.popBool()
+		if err != nil {
+			return err
+		}
+		i.push(a && b)
+		return nil
+	}
+	i.opcodes["or"] = func(i *Interpreter) error {
+		b, err := i.popBool()
+		if err != nil {
+			return err
+		}
+		a, err := i.popBool()
+		if err != nil {
+			return err
+		}
+		i.push(a || b)
+		return nil
+	}
+	i.opcodes["not"] = func(i *Interpreter) error {
+		a, err := i.popBool()
+		if err != nil {
+			return err
+		}
+		i.push(!a)
+		return nil
+	}
+	i.opcodes["xor"] = func(i *Interpreter) error {
+		b, err := i.popBool()
+		if err != nil {
+			return err
+		}
+		a, err := i.popBool()
+		if err != nil {
+			return err
+		}
+		i.push(a != b)
+		return nil
+	}
+
+	i.opcodes["set"] = func(i *Interpreter) error {
+		name, err := i.popString()
+		if err != nil {
+			return err
+		}
+
+		// Prevent defining variables with the same name as an opcode
+		if _, exists := i.opcodes[name]; exists {
+			return i.newError(11, name)
+		}
+
+		// Handle internal variables (names starting with '_')
+		if strings.HasPrefix(name, "_") {
+			// Check if it's an attempt to create a *new* internal variable
+			if _, exists := i.variables[name]; !exists {
+				return i.newError(12, name)
+			}
+
+			// If it's an *existing* internal variable, apply type protection
+			switch {
+			case booleanSettings[name]:
+				// These are boolean flags, so allow setting them to true
+			default:
+				return i.newError(14, name)
+			}
+		}
+
+		i.variables[name] = true
+		return nil
+	}
+
+	i.opcodes["unset"] = func(i *Interpreter) error {
+		name, err := i.popString()
+		if err != nil {
+			return err
+		}
+
+		// Prevent defining variables with the same name as an opcode
+		if _, exists := i.opcodes[name]; exists {
+			return i.newError(11, name)
+		}
+
+		// Handle internal variables (names starting with '_')
+		if strings.HasPrefix(name, "_") {
+			// Check if it's an attempt to create a *new* internal variable
+			if _, exists := i.variables[name]; !exists {
+				return i.newError(12, name)
+			}
+
+			// If it's an *existing* internal variable, apply type protection
+			switch {
+			case name == "_sandbox":
+				return i.newError(78)
+			case booleanSettings[name]:
+				// These are boolean flags, so allow setting them to false
+			default:
+				return i.newError(14, name)
+			}
+		}
+
+		i.variables[name] = false
+		return nil
+	}
+
+	i.opcodes["toggle"] = func(i *Interpreter) error {
+		name, err := i.popString()
+		if err != nil {
+			return err
+		}
+
+		// Prevent toggling variables with the same name as an opcode
+		if _, exists := i.opcodes[name]; exists {
+			return i.newError(11, name)
+		}
+
+		val, ok := i.variables[name]
+		if !ok {
+			return i.newError(15, name)
+		}
+
+		b, isBool := val.(bool)
+		if !isBool {
+			return i.newError(4, TypeName(val))
+		}
+
+		// Handle internal variables (names starting with '_')
+		if strings.HasPrefix(name, "_") {
+			// Only allow toggling of specific internal boolean variables
+			switch {
+			case name == "_sandbox" && b:
+				return i.newError(78)
+			case booleanSettings[name]:
+				// These are boolean flags, so allow toggling them
+			default:
+				return i.newError(14, name)
+			}
+		}
+
+		i.variables[name] = !b
+		return nil
+	}
+
+	// String case conversion
+	i.opcodes["upper"] = func(i *Interpreter) error {
+		s, err := i.popString()
+		if err != nil {
+			return err
+		}
+		i.push(strings.ToUpper(s))
+		return nil
+	}
+	i.opcodes["lower"] = func(i *Interpreter) error {
+		s, err := i.popString()
+		if err != nil {
+			return err
+		}
+		i.push(strings.ToLower(s))
+		return nil
+	}
+
+	i.opcodes["val"] = func(i *Interpreter) error {
+		s, err := i.popString()
+		if err != nil {
+			return err
+		}
+		// Try to parse as a boolean
+		if s == "true" {
+			i.push(true)
+		} else if s == "false" {
+			i.push(false)
+		} else {
+			// Try to parse as a number
+			if n, ok := i.literal(s); ok {
+				i.push(n)
+			} else {
+				// If it's neither, push the original string back
+				i.push(s)
+			}
+		}
+		return nil
+	}
+
+	i.opcodes["str"] = func(i *Interpreter) error {
+		v, err := i.pop()
+		if err != nil {
+			return err
+		}
+		i.push(i.Format(v))
+		return nil
+	}
+
+	// UTF-8 commands
+	i.opcodes["code"] = func(i *Interpreter) error {
+		s, err := i.popString()
+		if err != nil {
+			return err
+		}
+		if len(s) == 0 {
+			return i.newError(58, "empty string")
+		}
+		runeValue := []rune(s)[0]
+		i.push(newInt(int(runeValue)))
+		return nil
+	}
+
+	i.opcodes["char"] = func(i *Interpreter) error {
+		runeValue, err := i.popCode()
+		if err != nil {
+			return err
+		}
+		i.push(string(runeValue))
+		return nil
+	}
+
+	i.opcodes["emit"] = func(i *Interpreter) error {
+		runeValue, err := i.popCode()
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(i.output, string(runeValue))
+		return nil
+	}
+
+	// Math functions
+	i.opcodes["inv"] = func(i *Interpreter) error {
+		if i.hasMatrixOperand(1) {
+			m, _ := i.popMatrix()
+			r, err := i.solve("inv", m, identity(m.rows))
+			if err != nil {
+				return err
+			}
+			i.push(r)
+			return nil
+		}
+		x, err := i.popNumber()
+		if err != nil {
+			return err
+		}
+		one, x := promote(newInt(1), x)
+		q, err := i.divNumbers(one, x)
+		if err != nil {
+			return err
+		}
+		i.push(q)
+		return nil
+	}
+
+	i.opcodes["chs"] = func(i *Interpreter) error {
+		a, err := i.popNumber()
+		if err != nil {
+			return err
+		}
+		i.push(i.wrapValue(negNumber(a)))
+		return nil
+	}
+
+	i.opcodes["abs"] = func(i *Interpreter) error {
+		a, err := i.popNumber()
+		if err != nil {
+			return err
+		}
+		i.push(i.wrapValue(absNumber(a)))
+		return nil
+	}
+
+	i.opcodes["gamma"] = func(i *Interpreter) error {
+		a, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		i.push(math.Gamma(a))
+		return nil
+	}
+
+	// Exit, the front-end decides what to do with it
+	i.opcodes["exit"] = func(i *Interpreter) error {
+		return ErrExit
+	}
+	i.opcodes["quit"] = i.opcodes["exit"]
+	i.opcodes["bye"] = i.opcodes["exit"]
+
+	// Help
+	i.opcodes["help"] = func(i *Interpreter) error {
+		// Describe a single command if its name is on top of the stack, error
+		// 21 telling that it is unknown
+		if i.helpOnStack() {
+			name, err := i.popString()
+			if err != nil {
+				return err
+			}
+			return i.writeDescription(i.output, name)
+		}
+		fmt.Fprintln(i.output, i.help)
+		i.writeRegisteredHelp(i.output)
+		return nil
+	}
+
+	i.opcodes["apropos"] = func(i *Interpreter) error {
+		search, err := i.popString()
+		if err != nil {
+			return err
+		}
+		i.apropos(i.output, search)
+		return nil
+	}
+}
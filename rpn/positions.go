@@ -0,0 +1,74 @@
+package rpn
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Pos is the position of a token in its source: the file it was read from, or
+// "<input>" for a command line, and its line and column, starting at 1.
+type Pos struct {
+	Source string
+	Line   int
+	Column int
+}
+
+// IsValid reports whether the position is known.
+func (p Pos) IsValid() bool {
+	return p.Line > 0
+}
+
+// String returns the position as source:line:column.
+func (p Pos) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.Source, p.Line, p.Column)
+}
+
+// locate records the positions of the tokens read from a source. Tokens are
+// identified by their address, which is kept by the blocks and word definitions
+// sliced out of them, so the positions of the previous evaluation of the source
+// are kept as long as words defined by it remain.
+func (i *Interpreter) locate(source string, tokens []string, positions []Pos) {
+	located := make(map[*string]Pos, len(tokens))
+	for k := range tokens {
+		located[&tokens[k]] = positions[k]
+	}
+	if previous, ok := i.sources[source]; ok {
+		i.oldSources = append(i.oldSources, previous)
+	}
+	i.sources[source] = located
+	i.forgetSources()
+}
+
+// forgetSources drops the positions of the earlier evaluations once the words
+// they defined are all redefined or deleted.
+func (i *Interpreter) forgetSources() {
+	i.oldSources = slices.DeleteFunc(i.oldSources, func(located map[*string]Pos) bool {
+		for _, def := range i.words {
+			if len(def) > 0 {
+				if _, ok := located[&def[0]]; ok {
+					return false
+				}
+			}
+		}
+		return true
+	})
+}
+
+// position returns the position of a token, or the zero Pos if it was not read
+// from a source (blocks built at run time, state restored from a file...).
+func (i *Interpreter) position(token *string) Pos {
+	if token == nil {
+		return Pos{}
+	}
+	for _, located := range i.sources {
+		if pos, ok := located[token]; ok {
+			return pos
+		}
+	}
+	for _, located := range i.oldSources {
+		if pos, ok := located[token]; ok {
+			return pos
+		}
+	}
+	return Pos{}
+}
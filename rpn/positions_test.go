@@ -0,0 +1,41 @@
+package rpn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWordPositions(t *testing.T) {
+	for _, noCompile := range []bool{false, true} {
+		i := NewInterpreter(Options{})
+		i.noCompile = noCompile
+		for _, source := range []string{": f 1 0 / ;", "1", "2"} {
+			if err := i.EvalSource("<input>", source); err != nil {
+				t.Fatalf("%q: %v", source, err)
+			}
+		}
+
+		// The word is called from a later command line
+		var perr *PolishError
+		if err := i.EvalSource("<input>", "f"); !errors.As(err, &perr) {
+			t.Fatalf("f: got %v, want an error", err)
+		}
+		if want := (Pos{"<input>", 1, 9}); perr.Pos != want {
+			t.Errorf("noCompile %v: '%s' at %v, want %v", noCompile, perr.Token, perr.Pos, want)
+		}
+		if len(i.oldSources) != 1 {
+			t.Errorf("noCompile %v: %d earlier evaluations kept, want 1", noCompile, len(i.oldSources))
+		}
+
+		// Its positions are dropped once it is redefined
+		if err := i.EvalSource("<input>", ": f 2 ;"); err != nil {
+			t.Fatal(err)
+		}
+		if err := i.EvalSource("<input>", "3"); err != nil {
+			t.Fatal(err)
+		}
+		if len(i.oldSources) != 1 {
+			t.Errorf("noCompile %v: %d earlier evaluations kept after the redefinition, want 1", noCompile, len(i.oldSources))
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package rpn
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Opcode describes a native Go word added to the interpreter with Register.
+type Opcode struct {
+	Name     string                   // Name of the word
+	Effect   string                   // Stack effect, e.g. "( a b -- a+b )"
+	Category string                   // Category used to group the words in the help
+	Help     string                   // Short description of the word
+	Examples []string                 // Usage examples
+	Arity    int                      // Number of stack items required, checked before calling Fn
+	Fn       func(*Interpreter) error // Implementation of the word
+
+	Privileged bool // The word accesses files or processes, and is refused in sandbox mode
+}
+
+// Register adds a native word to the interpreter. The word is then available to
+// the scripts, and is listed by 'help', 'words' and the tab completion.
+//
+// The name cannot start with '_' nor contain spaces, and it cannot conflict with
+// an existing command, word or variable.
+func (i *Interpreter) Register(op Opcode) error {
+	if op.Name == "" || op.Fn == nil || op.Arity < 0 {
+		return i.newError(63, op.Name)
+	}
+	if strings.ContainsAny(op.Name, " \t\n") {
+		return i.newError(55, op.Name)
+	}
+	if strings.HasPrefix(op.Name, "_") {
+		return i.newError(17, op.Name)
+	}
+	if _, exists := i.opcodes[op.Name]; exists {
+		return i.newError(62, op.Name)
+	}
+	if _, exists := i.words[op.Name]; exists {
+		return i.newError(62, op.Name)
+	}
+	if _, exists := i.variables[op.Name]; exists {
+		return i.newError(62, op.Name)
+	}
+
+	fn := op.Fn
+	arity := op.Arity
+	i.opcodes[op.Name] = func(i *Interpreter) error {
+		if len(i.stack) < arity {
+			return i.newError(1) // Stack underflow
+		}
+		return fn(i)
+	}
+	if op.Privileged {
+		i.opcodes[op.Name] = guard(op.Name, i.opcodes[op.Name])
+	}
+	i.registered[op.Name] = op
+	// The name may have been compiled as a word or a variable
+	i.programs = make(map[programKey]*program)
+	return nil
+}
+
+// writeRegisteredHelp writes the description of the registered words, grouped by category.
+func (i *Interpreter) writeRegisteredHelp(w io.Writer) {
+	if len(i.registered) == 0 {
+		return
+	}
+	ops := make([]Opcode, 0, len(i.registered))
+	for _, op := range i.registered {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(a, b int) bool {
+		if ops[a].Category != ops[b].Category {
+			return ops[a].Category < ops[b].Category
+		}
+		return ops[a].Name < ops[b].Name
+	})
+
+	fmt.Fprintln(w, "\nExtensions")
+	category := ""
+	for k, op := range ops {
+		if k == 0 || op.Category != category {
+			category = op.Category
+			if category == "" {
+				fmt.Fprintln(w, "\n  Miscellaneous")
+			} else {
+				fmt.Fprintln(w, "\n  "+category)
+			}
+		}
+		fmt.Fprintf(w, "  * %s %s: %s\n", op.Name, op.Effect, op.Help)
+	}
+}
+
+// PopFloat removes the value on top of the stack, which must be a number or a boolean.
+func (i *Interpreter) PopFloat() (float64, error) {
+	return i.popFloat()
+}
+
+// PopBool removes the value on top of the stack, which must be a boolean or a number.
+func (i *Interpreter) PopBool() (bool, error) {
+	return i.popBool()
+}
+
+// PopString removes the value on top of the stack, which must be a string.
+func (i *Interpreter) PopString() (string, error) {
+	return i.popString()
+}
+
+// PopBlock removes the value on top of the stack, which must be a code block.
+func (i *Interpreter) PopBlock() ([]string, error) {
+	return i.popBlock()
+}
+
+// Output returns the writer used by '.', 'cr' and 'emit'.
+func (i *Interpreter) Output() io.Writer {
+	return i.output
+}
@@ -0,0 +1,52 @@
+package rpn
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// privilegedWords lists the built-in words accessing files or processes, which
+// are refused in sandbox mode. Registered opcodes are added with Opcode.Privileged.
+var privilegedWords = []string{"save", "restore", "import", "export", "list", "editfile"}
+
+// checkSandbox returns error 76 if the interpreter is in sandbox mode.
+func (i *Interpreter) checkSandbox(word string) error {
+	if i.Flag("_sandbox") {
+		return i.newError(76, word)
+	}
+	return nil
+}
+
+// guard wraps the opcode of a privileged word with the sandbox check.
+func guard(name string, fn func(*Interpreter) error) func(*Interpreter) error {
+	return func(i *Interpreter) error {
+		if err := i.checkSandbox(name); err != nil {
+			return err
+		}
+		return fn(i)
+	}
+}
+
+// guardPrivilegedWords wraps the privileged built-in opcodes. 'editfile', which is
+// handled by the parser, checks the sandbox mode itself.
+func (i *Interpreter) guardPrivilegedWords() {
+	for _, name := range privilegedWords {
+		if fn := i.opcodes[name]; fn != nil {
+			i.opcodes[name] = guard(name, fn)
+		}
+	}
+}
+
+// checkFileName refuses the file names leaving DataDir: absolute paths and paths
+// containing a ".." element. This applies even outside sandbox mode.
+func (i *Interpreter) checkFileName(filename string) error {
+	if filepath.IsAbs(filename) || strings.HasPrefix(filename, "/") || strings.HasPrefix(filename, `\`) {
+		return i.newError(77, filename)
+	}
+	for _, part := range strings.FieldsFunc(filename, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part == ".." {
+			return i.newError(77, filename)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package rpn
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+)
+
+// InterpreterState represents the savable state of the interpreter. Values are
+// stored as returned by encodeValue.
+type InterpreterState struct {
+	Stack     []interface{}          `json:"stack"`
+	Variables map[string]interface{} `json:"variables"`
+	Words     map[string][]string    `json:"words"`
+}
+
+// DataDir is the directory, relative to the user's home, holding the state and script files.
+var DataDir = ".polish"
+
+// SaveState saves the current interpreter state to a file of DataDir.
+func (i *Interpreter) SaveState(filename string) error {
+	if err := i.checkFileName(filename); err != nil {
+		return err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return i.newError(40, err)
+	}
+	rpnPath := filepath.Join(home, DataDir)
+	if err := os.MkdirAll(rpnPath, 0755); err != nil {
+		return i.newError(41, err)
+	}
+	fullPath := filepath.Join(rpnPath, filename)
+
+	state := InterpreterState{
+		Stack:     make([]interface{}, len(i.stack)),
+		Variables: make(map[string]interface{}, len(i.variables)),
+		Words:     i.words,
+	}
+	for k, val := range i.stack {
+		state.Stack[k] = encodeValue(val)
+	}
+	for name, val := range i.variables {
+		state.Variables[name] = encodeValue(val)
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return i.newError(42, err)
+	}
+
+	err = ioutil.WriteFile(fullPath, data, 0644)
+	if err != nil {
+		return i.newError(43, fullPath, err)
+	}
+	return nil
+}
+
+// LoadState loads the interpreter state from a file of DataDir.
+func (i *Interpreter) LoadState(filename string) error {
+	if err := i.checkFileName(filename); err != nil {
+		return err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return i.newError(40, err)
+	}
+	rpnPath := filepath.Join(home, DataDir)
+	fullPath := filepath.Join(rpnPath, filename)
+
+	data, err := ioutil.ReadFile(fullPath)
+	if err != nil {
+		return i.newError(44, fullPath, err)
+	}
+
+	var state InterpreterState
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return i.newError(45, err)
+	}
+
+	for k, val := range state.Stack {
+		state.Stack[k] = decodeItem(val)
+	}
+	i.stack = state.Stack
+	// Do not overwrite the build-time version, nor the sandbox mode of the session
+	delete(state.Variables, "_version")
+	delete(state.Variables, "_sandbox")
+	// Merge loaded variables into existing ones.
+	// Internal variables (starting with '_') are updated if they exist in the loaded state,
+	// allowing their state to persist across sessions.
+	for k, v := range state.Variables {
+		i.variables[k] = decodeItem(v)
+	}
+	if state.Words == nil {
+		i.words = make(map[string][]string)
+	} else {
+		i.words = state.Words
+	}
+	i.notify(StackChanged)
+	i.notify(VariablesChanged)
+	i.wordsChanged()
+	return nil
+}
+
+// encodeValue returns the JSON representation of a value. Integers, fractions,
+// decimals and complex numbers are written as {"$int": "digits"},
+// {"$rat": "a/b"}, {"$dec": "digits.digits"} and {"$cx": "(re,im)"}, so that
+// they are not read back as float64, lists as {"$list": [...]}, so that they
+// are not read back as code blocks, maps as {"$map": {...}}, so that a map
+// having a key such as "$int" is not read back as a number, and matrices as
+// {"$matrix": [[...], ...]}.
+func encodeValue(val interface{}) interface{} {
+	switch n := val.(type) {
+	case *big.Int:
+		return map[string]string{"$int": n.String()}
+	case *big.Rat:
+		return map[string]string{"$rat": n.String()}
+	case *decimal:
+		return map[string]string{"$dec": n.String()}
+	case complex128:
+		return map[string]string{"$cx": formatComplex(n)}
+	case list:
+		items := make([]interface{}, len(n))
+		for k, item := range n {
+			items[k] = encodeValue(item)
+		}
+		return map[string]interface{}{"$list": items}
+	case dict:
+		entries := make(map[string]interface{}, len(n))
+		for key, item := range n {
+			entries[key] = encodeValue(item)
+		}
+		return map[string]interface{}{"$map": entries}
+	case *matrix:
+		return map[string][][]float64{"$matrix": encodeMatrix(n)}
+	case mark:
+		return map[string]string{"$mark": string(n)}
+	}
+	return val
+}
+
+// decodeValue converts a value read from a state file, as written by encodeValue.
+func decodeValue(val interface{}) interface{} {
+	if m, ok := val.(map[string]interface{}); ok && len(m) == 1 {
+		if s, ok := m["$int"].(string); ok {
+			if n, ok := new(big.Int).SetString(s, 10); ok {
+				return n
+			}
+		}
+		if s, ok := m["$rat"].(string); ok {
+			if r, ok := parseFraction(s); ok {
+				return r
+			}
+		}
+		if s, ok := m["$dec"].(string); ok {
+			if d, ok := parseDecimal(s); ok {
+				return d
+			}
+		}
+		if s, ok := m["$cx"].(string); ok {
+			if z, ok := parseComplex(s); ok {
+				return z
+			}
+		}
+		if items, ok := m["$list"].([]interface{}); ok {
+			return decodeList(items)
+		}
+		if entries, ok := m["$map"].(map[string]interface{}); ok {
+			return decodeDict(entries)
+		}
+		if rows, ok := m["$matrix"].([]interface{}); ok {
+			if x, ok := decodeMatrix(rows); ok {
+				return x
+			}
+		}
+		if s, ok := m["$mark"].(string); ok {
+			return mark(s)
+		}
+	}
+	return val
+}
@@ -0,0 +1,64 @@
+package rpn
+
+import "testing"
+
+func TestSaveRestoreRoundTrip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{"float", "1.5 -0.25e-10"},
+		{"bool", "true false"},
+		{"string", `"héllo" ""`},
+		{"block", "{ 1 2 + } { }"},
+		{"integer", "2 100 pow 0 -7"},
+		{"decimal", "19.90d -0.001d"},
+		{"rational", "1/3 -22/7"},
+		{"complex", "(1,-2) (0,0.5)"},
+		{"list", `[ 1 "a" { dup } [ 2 [ ] ] 1/2 ] [ ]`},
+		{"map", `<< "k" [ 1 2 ] "m" << "n" 1/2 >> "f" { drop } >> << >>`},
+		{"matrix", "[| 1 2 | 3 4 |] [| 0.5 -1 |]"},
+		{"mark", "[ <<"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			saved := NewInterpreter(Options{})
+			if err := saved.Eval(test.source + ` "v" store ` + test.source); err != nil {
+				t.Fatalf("%q: %v", test.source, err)
+			}
+			if err := saved.SaveState("roundtrip.json"); err != nil {
+				t.Fatal(err)
+			}
+			restored := NewInterpreter(Options{})
+			if err := restored.LoadState("roundtrip.json"); err != nil {
+				t.Fatal(err)
+			}
+
+			want, got := saved.Stack(), restored.Stack()
+			if v, ok := saved.Variable("v"); ok {
+				want = append(want, v)
+			}
+			if v, ok := restored.Variable("v"); ok {
+				got = append(got, v)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("%q: restored %d values, want %d", test.source, len(got), len(want))
+			}
+			for k := range want {
+				if _, ok := want[k].([]string); ok {
+					if _, ok := got[k].([]string); !ok {
+						t.Errorf("%q: block %d restored as a %T", test.source, k, got[k])
+					}
+				}
+				if TypeName(got[k]) != TypeName(want[k]) {
+					t.Errorf("%q: value %d restored as a %s, want a %s", test.source, k, TypeName(got[k]), TypeName(want[k]))
+				}
+				if restored.formatItem(got[k]) != saved.formatItem(want[k]) {
+					t.Errorf("%q: value %d restored as %s, want %s", test.source, k, restored.formatItem(got[k]), saved.formatItem(want[k]))
+				}
+			}
+		})
+	}
+}
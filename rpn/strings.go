@@ -0,0 +1,382 @@
+package rpn
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+)
+
+// The string words count and index characters as a reader sees them: grapheme
+// clusters, so that "é" is one character whether it is written as one code
+// point or as an 'e' followed by a combining accent. 'bytelen' gives the size
+// of the UTF-8 encoding.
+
+// characters splits a string into its characters.
+func characters(s string) []string {
+	var chars []string
+	g := uniseg.NewGraphemes(s)
+	for g.Next() {
+		chars = append(chars, g.Str())
+	}
+	return chars
+}
+
+// charCount returns the number of characters of a string.
+func charCount(s string) int {
+	return uniseg.GraphemeClusterCount(s)
+}
+
+// popCode pops a Unicode code point, for 'char' and 'emit'.
+func (i *Interpreter) popCode() (rune, error) {
+	val, err := i.popReal()
+	if err != nil {
+		return 0, err
+	}
+	code, _ := toFloat(val)
+	r := rune(code)
+	if float64(r) != code || !utf8.ValidRune(r) {
+		return 0, i.newError(58, "invalid code point "+i.Format(val))
+	}
+	return r, nil
+}
+
+// maxStringSize limits the size in bytes of the strings built by 'repeat'.
+const maxStringSize = 1 << 24
+
+// indexChars returns the position of the first occurrence of sub in chars, or -1.
+func indexChars(chars, sub []string) int {
+	for k := 0; k+len(sub) <= len(chars); k++ {
+		if slices.Equal(chars[k:k+len(sub)], sub) {
+			return k
+		}
+	}
+	return -1
+}
+
+// lastIndexChars returns the position of the last occurrence of sub in chars, or -1.
+func lastIndexChars(chars, sub []string) int {
+	for k := len(chars) - len(sub); k >= 0; k-- {
+		if slices.Equal(chars[k:k+len(sub)], sub) {
+			return k
+		}
+	}
+	return -1
+}
+
+// replaceChars replaces the first n occurrences of old in s by new, or all of
+// them if n is negative. Unlike strings.Replace, an occurrence must start and
+// end on character boundaries, and an empty old string matches nowhere.
+func replaceChars(s, old, new string, n int) string {
+	chars, sub := characters(s), characters(old)
+	if len(sub) == 0 {
+		return s
+	}
+	var builder strings.Builder
+	for n != 0 {
+		k := indexChars(chars, sub)
+		if k < 0 {
+			break
+		}
+		builder.WriteString(strings.Join(chars[:k], ""))
+		builder.WriteString(new)
+		chars = chars[k+len(sub):]
+		n--
+	}
+	builder.WriteString(strings.Join(chars, ""))
+	return builder.String()
+}
+
+// splitChars splits s around the occurrences of sep, or into its characters if
+// sep is empty.
+func splitChars(s, sep string) []string {
+	chars, sub := characters(s), characters(sep)
+	if len(sub) == 0 {
+		return chars
+	}
+	var pieces []string
+	for {
+		k := indexChars(chars, sub)
+		if k < 0 {
+			break
+		}
+		pieces = append(pieces, strings.Join(chars[:k], ""))
+		chars = chars[k+len(sub):]
+	}
+	return append(pieces, strings.Join(chars, ""))
+}
+
+// popStrings pops the operands a and b of a binary string word, b being on top
+// of the stack.
+func (i *Interpreter) popStrings() (string, string, error) {
+	b, err := i.popString()
+	if err != nil {
+		return "", "", err
+	}
+	a, err := i.popString()
+	if err != nil {
+		return "", "", err
+	}
+	return a, b, nil
+}
+
+// popCompared pops the operands of a comparison and compares them, two strings
+// in lexicographic order and two numbers by value. It returns false if one of
+// the numbers is NaN.
+func (i *Interpreter) popCompared() (int, bool, error) {
+	if n := len(i.stack); n >= 2 {
+		_, aString := i.stack[n-2].(string)
+		_, bString := i.stack[n-1].(string)
+		if aString && bString {
+			a, b, _ := i.popStrings()
+			return strings.Compare(a, b), true, nil
+		}
+	}
+	a, b, err := i.popReals()
+	if err != nil {
+		return 0, false, err
+	}
+	c, ok := compareNumbers(a, b)
+	return c, ok, nil
+}
+
+// popCount pops a number of repetitions, an integer from 0 to max.
+func (i *Interpreter) popCount(word string, max int) (int, error) {
+	val, err := i.popReal()
+	if err != nil {
+		return 0, err
+	}
+	n, _ := toFloat(val)
+	if n != float64(int(n)) || n < 0 || int(n) > max {
+		return 0, i.newError(102, word, i.Format(val))
+	}
+	return int(n), nil
+}
+
+// registerStringOpcodes registers the words searching, splitting and
+// transforming strings.
+func (i *Interpreter) registerStringOpcodes() {
+	// s sub find, the position of the first occurrence or -1
+	i.opcodes["find"] = func(i *Interpreter) error {
+		s, sub, err := i.popStrings()
+		if err != nil {
+			return err
+		}
+		i.push(newInt(indexChars(characters(s), characters(sub))))
+		return nil
+	}
+	i.opcodes["rfind"] = func(i *Interpreter) error {
+		s, sub, err := i.popStrings()
+		if err != nil {
+			return err
+		}
+		i.push(newInt(lastIndexChars(characters(s), characters(sub))))
+		return nil
+	}
+	i.opcodes["contains"] = func(i *Interpreter) error {
+		s, sub, err := i.popStrings()
+		if err != nil {
+			return err
+		}
+		i.push(indexChars(characters(s), characters(sub)) >= 0)
+		return nil
+	}
+	i.opcodes["startswith"] = func(i *Interpreter) error {
+		s, prefix, err := i.popStrings()
+		if err != nil {
+			return err
+		}
+		chars, sub := characters(s), characters(prefix)
+		i.push(len(sub) <= len(chars) && slices.Equal(chars[:len(sub)], sub))
+		return nil
+	}
+	i.opcodes["endswith"] = func(i *Interpreter) error {
+		s, suffix, err := i.popStrings()
+		if err != nil {
+			return err
+		}
+		chars, sub := characters(s), characters(suffix)
+		i.push(len(sub) <= len(chars) && slices.Equal(chars[len(chars)-len(sub):], sub))
+		return nil
+	}
+
+	// s old new replace
+	replace := func(n int) func(*Interpreter) error {
+		return func(i *Interpreter) error {
+			old, new, err := i.popStrings()
+			if err != nil {
+				return err
+			}
+			s, err := i.popString()
+			if err != nil {
+				return err
+			}
+			i.push(replaceChars(s, old, new, n))
+			return nil
+		}
+	}
+	i.opcodes["replace"] = replace(1)
+	i.opcodes["replace-all"] = replace(-1)
+
+	// s sep split s1 ... sn n
+	i.opcodes["split"] = func(i *Interpreter) error {
+		s, sep, err := i.popStrings()
+		if err != nil {
+			return err
+		}
+		pieces := splitChars(s, sep)
+		for _, piece := range pieces {
+			i.push(piece)
+		}
+		i.push(newInt(len(pieces)))
+		return nil
+	}
+	// s1 ... sn n sep join, or list sep join
+	i.opcodes["join"] = func(i *Interpreter) error {
+		sep, err := i.popString()
+		if err != nil {
+			return err
+		}
+		var items []interface{}
+		isList := false
+		if len(i.stack) > 0 {
+			items, isList = i.stack[len(i.stack)-1].(list)
+		}
+		if isList {
+			i.pop()
+		} else {
+			n, err := i.popIndex("join", len(i.stack)-1)
+			if err != nil {
+				return err
+			}
+			items = slices.Clone(i.stack[len(i.stack)-n:])
+			i.stack = i.stack[:len(i.stack)-n]
+		}
+		pieces := make([]string, len(items))
+		for k, item := range items {
+			piece, ok := item.(string)
+			if !ok {
+				return i.newError(5, TypeName(item))
+			}
+			pieces[k] = piece
+		}
+		i.push(strings.Join(pieces, sep))
+		return nil
+	}
+
+	i.opcodes["trim"] = func(i *Interpreter) error {
+		s, err := i.popString()
+		if err != nil {
+			return err
+		}
+		i.push(strings.TrimSpace(s))
+		return nil
+	}
+	i.opcodes["ltrim"] = func(i *Interpreter) error {
+		s, err := i.popString()
+		if err != nil {
+			return err
+		}
+		i.push(strings.TrimLeftFunc(s, unicode.IsSpace))
+		return nil
+	}
+	i.opcodes["rtrim"] = func(i *Interpreter) error {
+		s, err := i.popString()
+		if err != nil {
+			return err
+		}
+		i.push(strings.TrimRightFunc(s, unicode.IsSpace))
+		return nil
+	}
+
+	// s n left, the first n characters
+	i.opcodes["left"] = func(i *Interpreter) error {
+		n, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		s, err := i.popString()
+		if err != nil {
+			return err
+		}
+		chars := characters(s)
+		if n < 0 || int(n) > len(chars) {
+			return i.newError(59)
+		}
+		i.push(strings.Join(chars[:int(n)], ""))
+		return nil
+	}
+	// s n right, the last n characters
+	i.opcodes["right"] = func(i *Interpreter) error {
+		n, err := i.popFloat()
+		if err != nil {
+			return err
+		}
+		s, err := i.popString()
+		if err != nil {
+			return err
+		}
+		chars := characters(s)
+		if n < 0 || int(n) > len(chars) {
+			return i.newError(59)
+		}
+		i.push(strings.Join(chars[len(chars)-int(n):], ""))
+		return nil
+	}
+
+	// s n repeat
+	i.opcodes["repeat"] = func(i *Interpreter) error {
+		max := maxStringSize
+		if len(i.stack) > 1 {
+			if s, ok := i.stack[len(i.stack)-2].(string); ok && len(s) > 0 {
+				max = maxStringSize / len(s)
+			}
+		}
+		n, err := i.popCount("repeat", max)
+		if err != nil {
+			return err
+		}
+		s, err := i.popString()
+		if err != nil {
+			return err
+		}
+		i.push(strings.Repeat(s, n))
+		return nil
+	}
+
+	// s width pad lpad, pad being the character added on the left up to the width
+	pad := func(word string, left bool) func(*Interpreter) error {
+		return func(i *Interpreter) error {
+			pad, err := i.popString()
+			if err != nil {
+				return err
+			}
+			width, err := i.popFloat()
+			if err != nil {
+				return err
+			}
+			s, err := i.popString()
+			if err != nil {
+				return err
+			}
+			if charCount(pad) != 1 {
+				return i.newError(58, word+": \""+pad+"\" is not one character")
+			}
+			n := int(width) - charCount(s)
+			if n <= 0 {
+				i.push(s)
+			} else if n > maxStringSize/len(pad) {
+				return i.newError(102, word, i.Format(width))
+			} else if left {
+				i.push(strings.Repeat(pad, n) + s)
+			} else {
+				i.push(s + strings.Repeat(pad, n))
+			}
+			return nil
+		}
+	}
+	i.opcodes["lpad"] = pad("lpad", true)
+	i.opcodes["rpad"] = pad("rpad", false)
+}
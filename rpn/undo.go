@@ -0,0 +1,116 @@
+package rpn
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// EvalRecorded evaluates a command line as Eval does, after recording the stack,
+// the variables and the words in the undo history. Commands using the history
+// ('undo', 'redo') and commands leaving the state unchanged are not recorded.
+func (i *Interpreter) EvalRecorded(source, text string) error {
+	saved := i.takeSnapshot(true)
+	saved.label = text
+	i.historyUsed = false
+
+	err := i.EvalSource(source, text)
+	if i.historyUsed || !i.changedSince(saved) {
+		return err
+	}
+	i.undos = append(i.undos, saved)
+	i.redos = nil
+	i.trimHistory()
+	return err
+}
+
+// changedSince reports whether the state differs from a full snapshot, the
+// variables reporting the last error being ignored.
+func (i *Interpreter) changedSince(s *snapshot) bool {
+	if !reflect.DeepEqual(i.stack, s.stack) || !reflect.DeepEqual(i.words, s.words) {
+		return true
+	}
+	if len(i.variables) != len(s.variables) {
+		return true
+	}
+	for name, val := range i.variables {
+		if name == "_error" || name == "_last_error" {
+			continue
+		}
+		if old, ok := s.variables[name]; !ok || !reflect.DeepEqual(val, old) {
+			return true
+		}
+	}
+	return false
+}
+
+// trimHistory drops the oldest snapshots beyond _undo_depth.
+func (i *Interpreter) trimHistory() {
+	depth := 0
+	if n, ok := toFloat(i.variables["_undo_depth"]); ok {
+		depth = int(n)
+	}
+	if len(i.undos) > depth {
+		i.undos = append([]*snapshot(nil), i.undos[len(i.undos)-depth:]...)
+	}
+}
+
+// Undo restores the state recorded before the last command, which can be
+// evaluated again with Redo.
+func (i *Interpreter) Undo() error {
+	if len(i.undos) == 0 {
+		return i.newError(69, "undo", "undo")
+	}
+	i.moveHistory(&i.undos, &i.redos)
+	return nil
+}
+
+// Redo restores the state undone by the last call to Undo.
+func (i *Interpreter) Redo() error {
+	if len(i.redos) == 0 {
+		return i.newError(69, "redo", "redo")
+	}
+	i.moveHistory(&i.redos, &i.undos)
+	return nil
+}
+
+// moveHistory restores the last snapshot of a list, after saving the current
+// state with the same label to the other list.
+func (i *Interpreter) moveHistory(from, to *[]*snapshot) {
+	last := (*from)[len(*from)-1]
+	*from = (*from)[:len(*from)-1]
+
+	current := i.takeSnapshot(true)
+	current.label = last.label
+	*to = append(*to, current)
+
+	i.restore(last)
+	i.historyUsed = true
+	i.notify(StackChanged)
+	i.notify(VariablesChanged)
+}
+
+// registerUndoOpcodes registers the words using the undo history.
+func (i *Interpreter) registerUndoOpcodes() {
+	i.opcodes["undo"] = func(i *Interpreter) error {
+		return i.Undo()
+	}
+
+	i.opcodes["redo"] = func(i *Interpreter) error {
+		return i.Redo()
+	}
+
+	// Lists the commands which can be undone, the next one first, then the ones
+	// which can be redone
+	i.opcodes["undos"] = func(i *Interpreter) error {
+		for k := len(i.undos) - 1; k >= 0; k-- {
+			fmt.Fprintf(i.output, "%3d: %s\n", len(i.undos)-k, i.undos[k].label)
+		}
+		if len(i.redos) > 0 {
+			fmt.Fprintln(i.output, "redo:")
+			for k := len(i.redos) - 1; k >= 0; k-- {
+				fmt.Fprintf(i.output, "%3d: %s\n", len(i.redos)-k, i.redos[k].label)
+			}
+		}
+		return nil
+	}
+}